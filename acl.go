@@ -0,0 +1,105 @@
+package main
+
+//Archivo con las listas de control de acceso (ACL) de los canales. Las reglas indican, para cada canal, qué
+//identidades (ver auth.go) pueden enviar archivos al canal y cuáles pueden suscribirse a él. El archivo de reglas se
+//puede volver a cargar sin reiniciar el servidor (SIGHUP)
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+//Acciones sobre un canal controladas por las reglas
+const (
+	ACL_PUBLISH   = "publish"
+	ACL_SUBSCRIBE = "subscribe"
+)
+
+//Constantes
+const ACL_ANYONE = "*" //Identidad de las reglas que corresponde a cualquier cliente (también a los no autenticados)
+
+//Reglas de acceso de los canales (nil: no hay restricciones). Se inicializa en main
+var accessRules *accessControl
+
+//Regla de un canal: identidades que pueden realizar cada acción
+type aclRule struct {
+	Publish   []string `json:"publish"`
+	Subscribe []string `json:"subscribe"`
+}
+
+//Contenido del archivo de reglas. Las reglas de "channels" se indican por nombre de canal (o patrón, para las
+//suscripciones a patrones); los canales sin regla usan "default" y, si no existe, no tienen restricciones
+type aclFile struct {
+	Default  *aclRule           `json:"default"`
+	Channels map[string]aclRule `json:"channels"`
+}
+
+type accessControl struct {
+	mutex sync.RWMutex
+	path  string
+	rules aclFile
+}
+
+//Función que carga las reglas del archivo indicado
+func loadAccessRules(path string) (*accessControl, error) {
+	var acl *accessControl = &accessControl{path: path}
+	if err := acl.reload(); err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
+
+//Función que vuelve a leer el archivo de reglas (si tiene errores se conservan las reglas anteriores)
+func (a *accessControl) reload() error {
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		return err
+	}
+	var rules aclFile
+	var decoder *json.Decoder = json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rules); err != nil {
+		return fmt.Errorf("ACL file %v: %w", a.path, err)
+	}
+	a.mutex.Lock()
+	a.rules = rules
+	a.mutex.Unlock()
+	return nil
+}
+
+//Función que indica si una identidad ("" si el cliente no se autenticó) puede realizar una acción sobre un canal
+func (a *accessControl) allows(identity string, channel string, action string) bool {
+	if a == nil {
+		return true
+	}
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	rule, found := a.rules.Channels[channel]
+	if !found {
+		if a.rules.Default == nil {
+			return true
+		}
+		rule = *a.rules.Default
+	}
+	var identities []string = rule.Subscribe
+	if action == ACL_PUBLISH {
+		identities = rule.Publish
+	}
+	for _, allowed := range identities {
+		if allowed == ACL_ANYONE || (allowed == identity && identity != "") {
+			return true
+		}
+	}
+	return false
+}
+
+//Función que retorna una descripción de la identidad de un cliente para los mensajes del servidor
+func describeIdentity(identity string) string {
+	if identity == "" {
+		return "anonymous"
+	}
+	return identity
+}
@@ -0,0 +1,115 @@
+package main
+
+//Archivo con la autenticación de los clientes. Si se configura un archivo de credenciales, los comandos que modifican
+//las suscripciones o envían archivos requieren que el cliente envíe antes, por la misma conexión, un mensaje
+//authenticate con uno de los tokens del archivo
+
+import (
+	"Server/protocol"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+)
+
+//Constantes
+const AUTH_TOKEN_MAX_LENGTH = 256 //Longitud máxima de un token de autenticación
+
+//Credenciales de los clientes (nil: la autenticación está deshabilitada). Se inicializa en main
+var credentials *credentialStore
+
+//Tokens válidos, por nombre de la identidad a la que pertenecen. El archivo tiene la forma {"nombre": "token", ...}
+type credentialStore struct {
+	mutex  sync.RWMutex
+	path   string
+	tokens map[string]string
+}
+
+//Función que carga las credenciales del archivo indicado
+func loadCredentials(path string) (*credentialStore, error) {
+	var store *credentialStore = &credentialStore{path: path}
+	if err := store.reload(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+//Función que vuelve a leer el archivo de credenciales (si tiene errores se conservan las credenciales anteriores)
+func (s *credentialStore) reload() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var tokens map[string]string
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return fmt.Errorf("credentials file %v: %w", s.path, err)
+	}
+	for name, token := range tokens {
+		if name == "" || token == "" || len(token) > AUTH_TOKEN_MAX_LENGTH {
+			return fmt.Errorf("credentials file %v: invalid entry %q", s.path, name)
+		}
+	}
+	s.mutex.Lock()
+	s.tokens = tokens
+	s.mutex.Unlock()
+	return nil
+}
+
+//Función que retorna la identidad a la que pertenece un token (found = false si el token no es válido)
+func (s *credentialStore) authenticate(token []byte) (identity string, found bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	//Se comparan todos los tokens para que el tiempo de respuesta no dependa de cuál coincide
+	for name, candidate := range s.tokens {
+		if subtle.ConstantTimeCompare(token, []byte(candidate)) == 1 {
+			identity, found = name, true
+		}
+	}
+	return identity, found
+}
+
+//Función que indica si un comando requiere que el cliente se haya autenticado
+func requiresAuthentication(command int8) bool {
+	switch command {
+	case protocol.COMMAND_SUBSCRIBE, protocol.COMMAND_SEND, protocol.COMMAND_SEND_REPORTED, protocol.COMMAND_UNSUBSCRIBE,
+		protocol.COMMAND_CREATE_CHANNEL, protocol.COMMAND_DELETE_CHANNEL, protocol.COMMAND_RECEIPT, protocol.COMMAND_LIST_CHANNELS:
+		return true
+	}
+	return false
+}
+
+//Función para procesar un mensaje authenticate. Retorna la identidad del cliente (status 0) o, si el token no es
+//válido, responde con un notify-failure
+func processAuthentication(connection net.Conn, decoder *protocol.Decoder, header protocol.Header) (returnIdentity string, returnStatus int) {
+	var reason string
+	if credentials == nil {
+		fmt.Println("ERROR: The client tried to authenticate but authentication is not enabled")
+		reason = "authentication is not enabled"
+	} else if header.Length <= 0 || header.Length > AUTH_TOKEN_MAX_LENGTH {
+		fmt.Println("ERROR: The client's message specified an invalid content length")
+		reason = "invalid content length"
+	} else {
+		var tokenBuffer []byte = make([]byte, header.Length)
+		if tokenError := decoder.ReadField("token", tokenBuffer); tokenError != nil {
+			fmt.Println("ERROR: Error while reading message's content: " + tokenError.Error())
+			_, err := connection.Write(createSimpleMessage(3, 0, []byte(decodeErrorReason(tokenError))))
+			if err != nil {
+				fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+			}
+			return "", 2
+		}
+		if identity, found := credentials.authenticate(tokenBuffer); found {
+			fmt.Printf("Client %v authenticated as %v\n", connection.RemoteAddr(), identity)
+			return identity, 0
+		}
+		fmt.Println("ERROR: Authentication failed for " + connection.RemoteAddr().String())
+		reason = "authentication failed"
+	}
+	_, err := connection.Write(createSimpleMessage(3, 0, []byte(reason)))
+	if err != nil {
+		fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+	}
+	return "", 3
+}
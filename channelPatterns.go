@@ -0,0 +1,83 @@
+package main
+
+//Archivo con el trie que contiene las suscripciones a patrones de canales (ej. "builds/*" o "assets/#"). Cada nivel
+//del trie corresponde a un segmento del patrón, de manera que obtener los suscriptores de un canal solo recorre las
+//ramas que coinciden con sus segmentos (y no todos los patrones registrados)
+
+import (
+	"Server/protocol"
+	"strings"
+	"time"
+)
+
+//Nodo del trie
+type patternNode struct {
+	children    map[string]*patternNode //Hijos por segmento (literal, "*" o "#")
+	subscribers subscriptionMap         //Suscripciones a los patrones que terminan en este nodo
+}
+
+//Función que retorna un nuevo nodo vacío
+func newPatternNode() *patternNode {
+	return &patternNode{children: make(map[string]*patternNode), subscribers: make(subscriptionMap)}
+}
+
+//Función que retorna el nodo correspondiente a un patrón (creándolo si create es true; si no, retorna nil cuando no
+//existe)
+func (n *patternNode) find(pattern string, create bool) *patternNode {
+	var node *patternNode = n
+	for _, segment := range strings.Split(pattern, protocol.CHANNEL_NAME_SEPARATOR) {
+		child, found := node.children[segment]
+		if !found {
+			if !create {
+				return nil
+			}
+			child = newPatternNode()
+			node.children[segment] = child
+		}
+		node = child
+	}
+	return node
+}
+
+//Función que agrega a found las direcciones suscritas (con el lease vigente) a algún patrón que coincide con los
+//segmentos restantes del nombre de un canal, junto con los filtros de esas suscripciones
+func (n *patternNode) match(segments []string, channel string, now time.Time, found map[string]*recipient) {
+	//"#" coincide con cualquier cantidad de segmentos restantes (incluso ninguno)
+	if tail, exists := n.children[protocol.CHANNEL_WILDCARD_TAIL]; exists {
+		tail.subscribers.collect(now, channel, found)
+	}
+	if len(segments) == 0 {
+		n.subscribers.collect(now, channel, found)
+		return
+	}
+	if child, exists := n.children[segments[0]]; exists {
+		child.match(segments[1:], channel, now, found)
+	}
+	if child, exists := n.children[protocol.CHANNEL_WILDCARD_ONE]; exists {
+		child.match(segments[1:], channel, now, found)
+	}
+}
+
+//Función que recorre todos los nodos con suscripciones, indicando el patrón que representa cada uno
+func (n *patternNode) walk(prefix string, visit func(pattern string, subscribers subscriptionMap)) {
+	if len(n.subscribers) > 0 {
+		visit(prefix, n.subscribers)
+	}
+	for segment, child := range n.children {
+		if prefix == "" {
+			child.walk(segment, visit)
+		} else {
+			child.walk(prefix+protocol.CHANNEL_NAME_SEPARATOR+segment, visit)
+		}
+	}
+}
+
+//Función que elimina los nodos sin suscripciones ni hijos. Retorna true si el nodo quedó vacío
+func (n *patternNode) prune() bool {
+	for segment, child := range n.children {
+		if child.prune() {
+			delete(n.children, segment)
+		}
+	}
+	return len(n.children) == 0 && len(n.subscribers) == 0
+}
@@ -0,0 +1,150 @@
+package main
+
+//Pruebas de las suscripciones a patrones de canales
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+//Función que retorna un registro sin canales numerados con una suscripción (de una dirección distinta) a cada patrón
+//indicado (ver testPatternAddress)
+func newTestPatternRegistry(t *testing.T, patterns []string) *channelRegistry {
+	t.Helper()
+	useTestConfig(t, func(c *serverConfig) { c.NumberOfChannels = 0 })
+	var registry *channelRegistry = newChannelRegistry(0, 0)
+	for i, pattern := range patterns {
+		if err := registry.append(testPatternAddress(i), pattern, subscription{}, 0); err != nil {
+			t.Fatalf("append(%q) error = %v", pattern, err)
+		}
+	}
+	return registry
+}
+
+//Función que retorna la dirección suscrita al patrón con el índice indicado
+func testPatternAddress(index int) string {
+	return "10.0.0.1:" + strconv.Itoa(7200+index)
+}
+
+//Función que retorna los patrones (según su dirección) que reciben los archivos de un canal, ordenados
+func matchedPatterns(registry *channelRegistry, patterns []string, channel string) []string {
+	var matched []string
+	for _, target := range registry.recipients(channel) {
+		for i, pattern := range patterns {
+			if target.address == testPatternAddress(i) {
+				matched = append(matched, pattern)
+			}
+		}
+	}
+	sort.Strings(matched)
+	return matched
+}
+
+func TestPatternRecipients(t *testing.T) {
+	var patterns = []string{
+		"assets/#",
+		"builds/*",
+		"builds/*/logs",
+		"*/nightly/#",
+		"*/*",
+		"#",
+		"a/*/#",
+		"a/b/c",
+	}
+	var registry *channelRegistry = newTestPatternRegistry(t, patterns)
+	var tests = []struct {
+		channel string
+		want    []string
+	}{
+		//"#" coincide con cero segmentos
+		{"assets", []string{"#", "assets/#"}},
+		{"assets/img", []string{"#", "*/*", "assets/#"}},
+		{"assets/img/png", []string{"#", "assets/#"}},
+		//"*" coincide con exactamente un segmento
+		{"builds", []string{"#"}},
+		{"builds/nightly", []string{"#", "*/*", "*/nightly/#", "builds/*"}},
+		{"builds/nightly/logs", []string{"#", "*/nightly/#", "builds/*/logs"}},
+		{"builds/nightly/logs/today", []string{"#", "*/nightly/#"}},
+		//Combinaciones de "*" y "#"
+		{"a/b", []string{"#", "*/*", "a/*/#"}},
+		{"a/b/c", []string{"#", "a/*/#", "a/b/c"}},
+		{"a/x/y/z", []string{"#", "a/*/#"}},
+		{"a", []string{"#"}},
+		{"x/nightly", []string{"#", "*/*", "*/nightly/#"}},
+	}
+	for _, test := range tests {
+		var got []string = matchedPatterns(registry, patterns, test.channel)
+		if strings.Join(got, " ") != strings.Join(test.want, " ") {
+			t.Errorf("recipients(%q) = %v, want %v", test.channel, got, test.want)
+		}
+	}
+}
+
+func TestPatternRecipientsAreNotRepeated(t *testing.T) {
+	useTestConfig(t, func(c *serverConfig) { c.NumberOfChannels = 0 })
+	var registry *channelRegistry = newChannelRegistry(0, 0)
+	for _, name := range []string{"builds/nightly", "builds/*", "builds/#"} {
+		if err := registry.append("10.0.0.1:1", name, subscription{}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var recipients []recipient = registry.recipients("builds/nightly")
+	if len(recipients) != 1 || len(recipients[0].filters) != 3 {
+		t.Fatalf("recipients = %+v, want one recipient with the filters of its 3 subscriptions", recipients)
+	}
+}
+
+func TestPatternPrune(t *testing.T) {
+	var patterns = []string{"a/*/#", "a/*/c", "a/b/#"}
+	var registry *channelRegistry = newTestPatternRegistry(t, patterns)
+
+	//Al cancelar una suscripción se eliminan solo los nodos que quedaron vacíos
+	registry.removeSubscriptor(testPatternAddress(0), "a/*/#")
+	if registry.patterns.find("a/*/#", false) != nil {
+		t.Error("node of the cancelled pattern a/*/# wasn't pruned")
+	}
+	if registry.patterns.find("a/*/c", false) == nil {
+		t.Error("node of the pattern a/*/c was pruned although it still has subscribers")
+	}
+	if got := matchedPatterns(registry, patterns, "a/x/c"); strings.Join(got, " ") != "a/*/c" {
+		t.Errorf("recipients(a/x/c) after pruning = %v, want [a/*/c]", got)
+	}
+
+	//Cancelar una suscripción inexistente no crea nodos
+	if err := registry.cancel(testPatternAddress(0), "x/*/#", ""); err != errNotSubscribed {
+		t.Errorf("cancel() of an unknown pattern error = %v, want errNotSubscribed", err)
+	}
+	if registry.patterns.find("x", false) != nil {
+		t.Error("cancelling an unknown pattern left nodes in the trie")
+	}
+
+	//Al cancelar las demás suscripciones el trie queda vacío
+	registry.removeSubscriptor(testPatternAddress(1), "a/*/c")
+	registry.removeSubscriptor(testPatternAddress(2), "a/b/#")
+	if len(registry.patterns.children) != 0 {
+		t.Errorf("trie isn't empty after cancelling every pattern subscription (children: %v)", len(registry.patterns.children))
+	}
+	if got := matchedPatterns(registry, patterns, "a/b/c"); len(got) != 0 {
+		t.Errorf("recipients(a/b/c) after cancelling every subscription = %v, want none", got)
+	}
+}
+
+func TestPatternPruneAfterRejectedRenewal(t *testing.T) {
+	useTestConfig(t, func(c *serverConfig) { c.NumberOfChannels = 0 })
+	var registry *channelRegistry = newChannelRegistry(0, 0)
+	if err := registry.append("10.0.0.1:1", "a/#", subscription{owner: "alice"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	//Otra identidad no puede renovar la suscripción, y el intento no deja nodos nuevos
+	if err := registry.append("10.0.0.1:1", "a/#", subscription{owner: "bob"}, 0); err != errSubscriptionOwned {
+		t.Fatalf("append() by another owner error = %v, want errSubscriptionOwned", err)
+	}
+	if err := registry.cancel("10.0.0.1:1", "a/#", "bob"); err != errSubscriptionOwned {
+		t.Fatalf("cancel() by another owner error = %v, want errSubscriptionOwned", err)
+	}
+	if registry.patterns.find("a/#", false) == nil {
+		t.Fatal("the subscription of the owner was pruned")
+	}
+}
@@ -0,0 +1,643 @@
+package main
+
+//Archivo que contiene la definición del registro de canales. Cada canal se identifica por su nombre (los canales
+//numerados 1-N se registran al iniciar con los nombres "1".."N"; los canales con nombre se crean bajo demanda o con el
+//comando create-channel, hasta config.MaxChannels, y se eliminan con delete-channel si no tienen suscriptores) y tiene
+//su propio mapa de suscriptores y su propia variable mutex para evitar condiciones de carrera, de manera que las
+//operaciones sobre canales distintos no se bloquean entre sí. Las suscripciones a patrones de canales se guardan
+//aparte, en un trie (ver channelPatterns.go)
+
+import (
+	"Server/protocol"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Constantes
+const LEASE_CHECK_INTERVAL = time.Second //Intervalo entre revisiones de leases vencidos
+
+//Errores de las operaciones sobre las suscripciones de otros clientes
+var (
+	errSubscriptionOwned = errors.New("subscription owned by another client")
+	errNotSubscribed     = errors.New("not subscribed")
+)
+
+//Errores de la creación y eliminación de canales
+var (
+	errChannelLimit    = errors.New("channel limit reached")
+	errUnknownChannel  = errors.New("unknown channel")
+	errNumberedChannel = errors.New("numbered channels can't be deleted")
+	errChannelNotEmpty = errors.New("channel has subscribers")
+)
+
+//Para cada canal existirá un mapa (las llaves serán las direcciones de los clientes y el valor los datos de su suscripción)
+type subscriptionMap map[string]subscription
+
+//Datos de una suscripción
+type subscription struct {
+	since   time.Time                    //Momento de la suscripción (no cambia al renovar el lease)
+	expires time.Time                    //Momento en que vence el lease (cero: la suscripción no vence)
+	filter  *protocol.SubscriptionFilter //Filtro de los archivos que recibe el suscriptor (nil: todos)
+	owner   string                       //Identidad del cliente que creó la suscripción ("" si no se autenticó)
+	//Identidad del certificado de cliente con el que se suscribió ("" si no usó uno). Si existe, el certificado que
+	//presenta el suscriptor al recibir los archivos debe corresponder a la misma identidad
+	certificate string
+	digest      bool //Indica si el suscriptor recibe los archivos con su digest al final del mensaje
+}
+
+//Suscriptor que debe recibir los archivos de un canal, con los filtros de sus suscripciones que coinciden con el canal
+//(el archivo se le envía si pasa alguno de ellos; un filtro nil acepta cualquier archivo)
+type recipient struct {
+	address     string
+	filters     []*protocol.SubscriptionFilter
+	certificate string //Identidad que debe tener el certificado del suscriptor ("" si no se verifica)
+	digest      bool   //Indica si alguna de sus suscripciones pidió recibir los archivos con su digest
+}
+
+//Función que indica si la suscripción venció en el momento indicado
+func (s subscription) expired(now time.Time) bool {
+	return !s.expires.IsZero() && !now.Before(s.expires)
+}
+
+//Función que agrega (o renueva) la suscripción de una dirección con el lease indicado (0: sin vencimiento) y los datos
+//de requested (dueño, certificado, filtro y digest), y la retorna. Una suscripción vigente conserva su momento original
+//y solo la puede renovar su dueño
+func (m subscriptionMap) renew(address string, requested subscription, lease time.Duration) (subscription, error) {
+	var now time.Time = time.Now()
+	current, found := m[address]
+	if !found || current.expired(now) {
+		current = subscription{since: now, owner: requested.owner}
+	} else if current.owner != requested.owner {
+		return current, errSubscriptionOwned
+	}
+	current.expires = time.Time{}
+	if lease > 0 {
+		current.expires = now.Add(lease)
+	}
+	current.filter = requested.filter
+	current.certificate = requested.certificate
+	current.digest = requested.digest
+	m[address] = current
+	return current, nil
+}
+
+//Función que retorna el registro que representa a la suscripción en el almacenamiento
+func (s subscription) record(address string, channel string) subscriptionRecord {
+	var record subscriptionRecord = subscriptionRecord{Operation: RECORD_SUBSCRIBE, Channel: channel, Address: address, Time: s.since, Filter: s.filter, Owner: s.owner, Certificate: s.certificate, Digest: s.digest}
+	if !s.expires.IsZero() {
+		var expires time.Time = s.expires
+		record.Expires = &expires
+	}
+	return record
+}
+
+//Canal registrado (el mutex protege a su mapa de suscriptores y a deleted)
+type channel struct {
+	mutex       sync.Mutex
+	name        string
+	created     time.Time
+	subscribers subscriptionMap
+	deleted     bool //Indica si el canal se eliminó (quien lo obtuvo antes de eso debe volver a obtenerlo)
+}
+
+type channelRegistry struct {
+	mutex        sync.RWMutex        //Protege al mapa de canales (no a los suscriptores de cada canal)
+	channels     map[string]*channel //Canales registrados, por nombre
+	patternMutex sync.Mutex          //Protege al trie de patrones
+	patterns     *patternNode        //Suscripciones a patrones de canales
+	store        *subscriptionStore  //Almacenamiento durable de las suscripciones (nil: solo en memoria)
+	maxChannels  int                 //Cantidad máxima de canales con nombre (0: sin límite)
+	named        int                 //Cantidad de canales con nombre registrados (protegido por mutex)
+}
+
+//Función que retorna un nuevo registro con los canales numerados indicados (1-N) que admite como máximo maxChannels
+//canales con nombre (0: sin límite)
+func newChannelRegistry(numberOfChannels int, maxChannels int) *channelRegistry {
+	var registry *channelRegistry = &channelRegistry{channels: make(map[string]*channel), patterns: newPatternNode(), maxChannels: maxChannels}
+	for i := 1; i <= numberOfChannels; i++ {
+		registry.create(strconv.Itoa(i))
+	}
+	return registry
+}
+
+//Función que retorna el nombre del canal numerado correspondiente al byte de canal de un mensaje ("" si no existe)
+func numberedChannel(number int8) string {
+	if number < 1 || int(number) > config.NumberOfChannels {
+		return ""
+	}
+	return strconv.Itoa(int(number))
+}
+
+//Función que retorna el byte de canal con el que se identifica un canal en los mensajes (protocol.NAMED_CHANNEL si
+//no es un canal numerado, en cuyo caso el contenido del mensaje debe empezar con el nombre del canal)
+func channelNumber(name string) int8 {
+	number, err := strconv.Atoi(name)
+	if err != nil || numberedChannel(int8(number)) != name {
+		return protocol.NAMED_CHANNEL
+	}
+	return int8(number)
+}
+
+//Función que crea un canal (si no existía). Retorna true si el canal se creó (errChannelLimit si se alcanzó la
+//cantidad máxima de canales con nombre)
+func (r *channelRegistry) create(name string) (bool, error) {
+	_, created, err := r.obtain(name, true)
+	return created, err
+}
+
+//Función que retorna un canal, creándolo si no existía (en ese caso retorna created = true). Si limited es true, un
+//canal con nombre nuevo solo se crea si no se alcanzó la cantidad máxima (si no, retorna errChannelLimit)
+func (r *channelRegistry) obtain(name string, limited bool) (ch *channel, created bool, err error) {
+	if ch = r.lookup(name); ch != nil {
+		return ch, false, nil
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if ch = r.channels[name]; ch != nil {
+		return ch, false, nil
+	}
+	var named bool = channelNumber(name) == protocol.NAMED_CHANNEL
+	if named && limited && r.maxChannels > 0 && r.named >= r.maxChannels {
+		return nil, false, errChannelLimit
+	}
+	ch = &channel{name: name, created: time.Now(), subscribers: make(subscriptionMap)}
+	r.channels[name] = ch
+	if named {
+		r.named++
+	}
+	//Registrar el canal en el almacenamiento (dentro del lock para que quede antes que sus suscripciones)
+	r.persist(subscriptionRecord{Operation: RECORD_CREATE, Channel: name, Time: ch.created})
+	return ch, true, nil
+}
+
+//Función que retorna un canal (creándolo si no existía) con su mutex bloqueado. Si el canal se eliminó mientras se
+//esperaba su mutex, se vuelve a obtener
+func (r *channelRegistry) obtainLocked(name string) (*channel, error) {
+	for {
+		ch, _, err := r.obtain(name, true)
+		if err != nil {
+			return nil, err
+		}
+		ch.mutex.Lock()
+		if !ch.deleted {
+			return ch, nil
+		}
+		ch.mutex.Unlock()
+	}
+}
+
+//Función que elimina un canal con nombre que no tiene suscriptores vigentes (las suscripciones vencidas se retiran).
+//Retorna errUnknownChannel si no existe, errNumberedChannel si es un canal numerado y errChannelNotEmpty si tiene
+//suscriptores
+func (r *channelRegistry) deleteChannel(name string) error {
+	if channelNumber(name) != protocol.NAMED_CHANNEL {
+		return errNumberedChannel
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var ch *channel = r.channels[name]
+	if ch == nil {
+		return errUnknownChannel
+	}
+	ch.mutex.Lock()
+	defer ch.mutex.Unlock()
+	var now time.Time = time.Now()
+	for _, current := range ch.subscribers {
+		if !current.expired(now) {
+			return errChannelNotEmpty
+		}
+	}
+	for address := range ch.subscribers {
+		delete(ch.subscribers, address)
+		r.persist(subscriptionRecord{Operation: RECORD_UNSUBSCRIBE, Channel: name, Address: address, Time: now})
+	}
+	ch.deleted = true
+	delete(r.channels, name)
+	r.named--
+	r.persist(subscriptionRecord{Operation: RECORD_DELETE, Channel: name, Time: now})
+	return nil
+}
+
+//Función que retorna un canal registrado (nil si no existe)
+func (r *channelRegistry) lookup(name string) *channel {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.channels[name]
+}
+
+//Función que retorna todos los canales registrados, ordenados por nombre (el orden en que se deben bloquear)
+func (r *channelRegistry) list() []*channel {
+	r.mutex.RLock()
+	var list []*channel = make([]*channel, 0, len(r.channels))
+	for _, ch := range r.channels {
+		list = append(list, ch)
+	}
+	r.mutex.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+	return list
+}
+
+//Función que añade un nuevo cliente a un canal (creándolo si no existía, ver obtain) o a un patrón de canales con el
+//lease indicado (0: sin vencimiento). requested indica la identidad que se suscribe (owner), la identidad del
+//certificado de cliente que usó (certificate, si usó uno), el filtro y si quiere recibir el digest de los archivos. Si
+//el cliente ya estaba suscrito, se renuevan su lease y sus opciones (retorna errSubscriptionOwned si la suscripción
+//pertenece a otra identidad)
+func (r *channelRegistry) append(address string, name string, requested subscription, lease time.Duration) error {
+	if protocol.IsChannelPattern(name) {
+		r.patternMutex.Lock()
+		defer r.patternMutex.Unlock()
+		current, err := r.patterns.find(name, true).subscribers.renew(address, requested, lease)
+		if err != nil {
+			r.patterns.prune()
+			return err
+		}
+		r.persist(current.record(address, name))
+		return nil
+	}
+	//Lock mutex
+	ch, err := r.obtainLocked(name)
+	if err != nil {
+		return err
+	}
+	defer ch.mutex.Unlock()
+	//Añadir el nuevo cliente al canal
+	current, err := ch.subscribers.renew(address, requested, lease)
+	if err != nil {
+		return err
+	}
+	//Registrar la suscripción en el almacenamiento (dentro del lock para mantener el orden de las operaciones)
+	r.persist(current.record(address, name))
+	return nil
+}
+
+//Función que retorna los suscriptores de un canal (omitiendo los que tienen el lease vencido)
+func (r *channelRegistry) readChannel(name string) []string {
+	var ch *channel = r.lookup(name)
+	if ch == nil {
+		return nil
+	}
+	//Lock mutex
+	ch.mutex.Lock()
+	//Crear una copia del las keys del mapa correspondiente
+	var now time.Time = time.Now()
+	var channelSubsCopy []string = make([]string, 0, len(ch.subscribers))
+	for address, current := range ch.subscribers {
+		if !current.expired(now) {
+			channelSubsCopy = append(channelSubsCopy, address)
+		}
+	}
+	//Unlock mutex
+	defer ch.mutex.Unlock()
+	return channelSubsCopy
+}
+
+//Función que retorna los suscriptores que deben recibir los archivos enviados a un canal: los suscritos al canal y los
+//suscritos a algún patrón que coincide con él (sin repetir, con los filtros de todas sus suscripciones). Se omiten las
+//suscripciones cuyo dueño ya no tiene permiso para suscribirse al canal
+func (r *channelRegistry) recipients(name string) []recipient {
+	var found map[string]*recipient = r.matchPatterns(name)
+	if ch := r.lookup(name); ch != nil {
+		ch.mutex.Lock()
+		ch.subscribers.collect(time.Now(), name, found)
+		ch.mutex.Unlock()
+	}
+	var recipients []recipient = make([]recipient, 0, len(found))
+	for _, target := range found {
+		recipients = append(recipients, *target)
+	}
+	return recipients
+}
+
+//Función que indica si una dirección recibe los archivos enviados a un canal (ver recipients)
+func (r *channelRegistry) hasRecipient(name string, address string) bool {
+	for _, target := range r.recipients(name) {
+		if target.address == address {
+			return true
+		}
+	}
+	return false
+}
+
+//Función que agrega a found las direcciones suscritas con el lease vigente cuyo dueño puede suscribirse al canal
+//indicado (junto con los filtros de sus suscripciones, la identidad de su certificado y si piden el digest)
+func (m subscriptionMap) collect(now time.Time, channel string, found map[string]*recipient) {
+	for address, current := range m {
+		if current.expired(now) || !accessRules.allows(current.owner, channel, ACL_SUBSCRIBE) {
+			continue
+		}
+		var target *recipient = found[address]
+		if target == nil {
+			target = &recipient{address: address}
+			found[address] = target
+		}
+		target.filters = append(target.filters, current.filter)
+		if target.certificate == "" {
+			target.certificate = current.certificate
+		}
+		target.digest = target.digest || current.digest
+	}
+}
+
+//Función que retorna las direcciones suscritas a algún patrón que coincide con un canal (con los filtros de esas
+//suscripciones)
+func (r *channelRegistry) matchPatterns(name string) map[string]*recipient {
+	var found map[string]*recipient = make(map[string]*recipient)
+	r.patternMutex.Lock()
+	r.patterns.match(strings.Split(name, protocol.CHANNEL_NAME_SEPARATOR), name, time.Now(), found)
+	r.patternMutex.Unlock()
+	return found
+}
+
+//Función que indica si se pueden enviar archivos a un canal: si está registrado o si algún patrón coincide con él
+func (r *channelRegistry) accepts(name string) bool {
+	return r.lookup(name) != nil || len(r.matchPatterns(name)) > 0
+}
+
+//Función que elimina un cliente de un determinado canal (o patrón de canales)
+func (r *channelRegistry) removeSubscriptor(address string, name string) {
+	r.remove(address, name, nil)
+}
+
+//Función que elimina la suscripción de un cliente a un canal (o patrón de canales) solo si pertenece a la identidad
+//indicada. Retorna errNotSubscribed si la suscripción no existe y errSubscriptionOwned si pertenece a otra identidad
+func (r *channelRegistry) cancel(address string, name string, owner string) error {
+	return r.remove(address, name, func(current subscription) error {
+		if current.owner != owner {
+			return errSubscriptionOwned
+		}
+		return nil
+	})
+}
+
+//Función que elimina la suscripción de un cliente a un canal (o patrón de canales) si check (opcional) no retorna un
+//error. Retorna errNotSubscribed si la suscripción no existe
+func (r *channelRegistry) remove(address string, name string, check func(current subscription) error) error {
+	var subscribers subscriptionMap
+	if protocol.IsChannelPattern(name) {
+		r.patternMutex.Lock()
+		defer r.patternMutex.Unlock()
+		if node := r.patterns.find(name, false); node != nil {
+			subscribers = node.subscribers
+		}
+		//Eliminar del trie los nodos que quedaron vacíos
+		defer r.patterns.prune()
+	} else if ch := r.lookup(name); ch != nil {
+		//Lock mutex
+		ch.mutex.Lock()
+		defer ch.mutex.Unlock()
+		subscribers = ch.subscribers
+	}
+	//Retirar el cliente del mapa correspondiente al canal
+	current, found := subscribers[address]
+	if !found {
+		return errNotSubscribed
+	}
+	if check != nil {
+		if err := check(current); err != nil {
+			return err
+		}
+	}
+	delete(subscribers, address)
+	//Registrar la cancelación en el almacenamiento
+	r.persist(subscriptionRecord{Operation: RECORD_UNSUBSCRIBE, Channel: name, Address: address, Time: time.Now()})
+	return nil
+}
+
+//Función que retira las suscripciones cuyo lease venció y retorna cuántas se retiraron
+func (r *channelRegistry) expire() int {
+	var expired int = 0
+	var now time.Time = time.Now()
+	for _, ch := range r.list() {
+		ch.mutex.Lock()
+		for address, current := range ch.subscribers {
+			if current.expired(now) {
+				delete(ch.subscribers, address)
+				r.persist(subscriptionRecord{Operation: RECORD_UNSUBSCRIBE, Channel: ch.name, Address: address, Time: now})
+				fmt.Printf("Subscription of %v to channel %v expired\n", address, ch.name)
+				expired++
+			}
+		}
+		ch.mutex.Unlock()
+	}
+	r.patternMutex.Lock()
+	r.patterns.walk("", func(pattern string, subscribers subscriptionMap) {
+		for address, current := range subscribers {
+			if current.expired(now) {
+				delete(subscribers, address)
+				r.persist(subscriptionRecord{Operation: RECORD_UNSUBSCRIBE, Channel: pattern, Address: address, Time: now})
+				fmt.Printf("Subscription of %v to channel pattern %v expired\n", address, pattern)
+				expired++
+			}
+		}
+	})
+	if expired > 0 {
+		r.patterns.prune()
+	}
+	r.patternMutex.Unlock()
+	return expired
+}
+
+//Función que retira periódicamente las suscripciones vencidas
+func (r *channelRegistry) runExpiry() {
+	for range time.Tick(LEASE_CHECK_INTERVAL) {
+		r.expire()
+	}
+}
+
+//Función que retorna los canales (y patrones de canales) a los que está suscrita una dirección
+func (r *channelRegistry) channelsOf(address string) []string {
+	var channels []string
+	for _, ch := range r.list() {
+		ch.mutex.Lock()
+		if _, found := ch.subscribers[address]; found {
+			channels = append(channels, ch.name)
+		}
+		ch.mutex.Unlock()
+	}
+	r.patternMutex.Lock()
+	r.patterns.walk("", func(pattern string, subscribers subscriptionMap) {
+		if _, found := subscribers[address]; found {
+			channels = append(channels, pattern)
+		}
+	})
+	r.patternMutex.Unlock()
+	return channels
+}
+
+//Función que retorna todas las direcciones suscritas a algún canal (sin repetir)
+func (r *channelRegistry) addresses() []string {
+	var seen map[string]bool = make(map[string]bool)
+	var addresses []string
+	for _, ch := range r.list() {
+		ch.mutex.Lock()
+		for address := range ch.subscribers {
+			if !seen[address] {
+				seen[address] = true
+				addresses = append(addresses, address)
+			}
+		}
+		ch.mutex.Unlock()
+	}
+	r.patternMutex.Lock()
+	r.patterns.walk("", func(pattern string, subscribers subscriptionMap) {
+		for address := range subscribers {
+			if !seen[address] {
+				seen[address] = true
+				addresses = append(addresses, address)
+			}
+		}
+	})
+	r.patternMutex.Unlock()
+	return addresses
+}
+
+//Función que retorna los canales registrados y los patrones de canales con suscripciones, con su cantidad de
+//suscriptores vigentes
+func (r *channelRegistry) describeChannels() []protocol.ChannelInfo {
+	var now time.Time = time.Now()
+	var infos []protocol.ChannelInfo = make([]protocol.ChannelInfo, 0)
+	for _, ch := range r.list() {
+		ch.mutex.Lock()
+		infos = append(infos, protocol.ChannelInfo{Name: ch.name, Subscribers: len(ch.subscribers.describe(now))})
+		ch.mutex.Unlock()
+	}
+	var patterns []protocol.ChannelInfo
+	r.patternMutex.Lock()
+	r.patterns.walk("", func(pattern string, subscribers subscriptionMap) {
+		patterns = append(patterns, protocol.ChannelInfo{Name: pattern, Pattern: true, Subscribers: len(subscribers.describe(now))})
+	})
+	r.patternMutex.Unlock()
+	sort.Slice(patterns, func(i, j int) bool { return patterns[i].Name < patterns[j].Name })
+	return append(infos, patterns...)
+}
+
+//Función que retorna los suscriptores vigentes de un canal (o de un patrón de canales). Retorna found = false si el
+//canal no existe
+func (r *channelRegistry) describeSubscribers(name string) (subscribers []protocol.SubscriberInfo, found bool) {
+	var now time.Time = time.Now()
+	if protocol.IsChannelPattern(name) {
+		r.patternMutex.Lock()
+		defer r.patternMutex.Unlock()
+		var node *patternNode = r.patterns.find(name, false)
+		if node == nil {
+			return nil, false
+		}
+		return node.subscribers.describe(now), true
+	}
+	var ch *channel = r.lookup(name)
+	if ch == nil {
+		return nil, false
+	}
+	ch.mutex.Lock()
+	defer ch.mutex.Unlock()
+	return ch.subscribers.describe(now), true
+}
+
+//Función que retorna la descripción de las suscripciones vigentes, ordenadas por antigüedad
+func (m subscriptionMap) describe(now time.Time) []protocol.SubscriberInfo {
+	var subscribers []protocol.SubscriberInfo = make([]protocol.SubscriberInfo, 0, len(m))
+	for address, current := range m {
+		if current.expired(now) {
+			continue
+		}
+		var record subscriptionRecord = current.record(address, "")
+		subscribers = append(subscribers, protocol.SubscriberInfo{Address: address, Owner: record.Owner, Certificate: record.Certificate, Since: record.Time, Expires: record.Expires, Filter: record.Filter, Digest: record.Digest})
+	}
+	sort.Slice(subscribers, func(i, j int) bool { return subscribers[i].Since.Before(subscribers[j].Since) })
+	return subscribers
+}
+
+//Función que asocia un almacenamiento durable al registro, restaurando los canales y las suscripciones guardadas en él
+func (r *channelRegistry) attachStore(store *subscriptionStore, records []subscriptionRecord) {
+	for _, record := range records {
+		if !protocol.IsValidChannelPattern(record.Channel) || (record.Operation == RECORD_CREATE && protocol.IsChannelPattern(record.Channel)) {
+			fmt.Printf("WARNING: Ignoring stored record of invalid channel %q\n", record.Channel)
+			continue
+		}
+		//Las suscripciones guardadas (posiblemente antes de que existiera la política actual) también deben cumplir la
+		//política de direcciones de suscriptores
+		if record.Operation == RECORD_SUBSCRIBE {
+			if policyError := checkSubscriberAddress(record.Address, nil); policyError != nil {
+				fmt.Printf("WARNING: Dropping stored subscription of %v to channel %v: %v\n", record.Address, record.Channel, policyError)
+				continue
+			}
+		}
+		var restored subscription = subscription{since: record.Time, filter: record.Filter, owner: record.Owner, certificate: record.Certificate, digest: record.Digest}
+		if record.Expires != nil {
+			restored.expires = *record.Expires
+		}
+		if protocol.IsChannelPattern(record.Channel) {
+			r.patternMutex.Lock()
+			r.patterns.find(record.Channel, true).subscribers[record.Address] = restored
+			r.patternMutex.Unlock()
+			continue
+		}
+		//Los canales guardados se restauran aunque superen la cantidad máxima actual
+		ch, _, _ := r.obtain(record.Channel, false)
+		if record.Operation == RECORD_CREATE {
+			ch.created = record.Time
+			continue
+		}
+		ch.mutex.Lock()
+		ch.subscribers[record.Address] = restored
+		ch.mutex.Unlock()
+	}
+	r.store = store
+}
+
+//Función que escribe un snapshot con todos los canales y suscripciones (también a patrones) en el almacenamiento
+func (r *channelRegistry) snapshot() error {
+	if r.store == nil {
+		return nil
+	}
+	//Bloquear la creación de canales, cada canal (siempre en el mismo orden) y los patrones para obtener una vista
+	//consistente
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	var names []string = make([]string, 0, len(r.channels))
+	for name := range r.channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r.channels[name].mutex.Lock()
+	}
+	var records []subscriptionRecord
+	for _, name := range names {
+		var ch *channel = r.channels[name]
+		//Los canales numerados se crean al iniciar, por lo que solo se guardan los canales con nombre
+		if channelNumber(name) == protocol.NAMED_CHANNEL {
+			records = append(records, subscriptionRecord{Operation: RECORD_CREATE, Channel: name, Time: ch.created})
+		}
+		for address, current := range ch.subscribers {
+			records = append(records, current.record(address, name))
+		}
+	}
+	r.patternMutex.Lock()
+	r.patterns.walk("", func(pattern string, subscribers subscriptionMap) {
+		for address, current := range subscribers {
+			records = append(records, current.record(address, pattern))
+		}
+	})
+	var err error = r.store.snapshot(records)
+	r.patternMutex.Unlock()
+	for _, name := range names {
+		r.channels[name].mutex.Unlock()
+	}
+	return err
+}
+
+//Función que registra una operación en el almacenamiento (si existe)
+func (r *channelRegistry) persist(record subscriptionRecord) {
+	if r.store == nil {
+		return
+	}
+	if err := r.store.record(record); err != nil {
+		fmt.Println("ERROR: Error while persisting subscription change: " + err.Error())
+	}
+}
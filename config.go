@@ -0,0 +1,395 @@
+package main
+
+//Archivo con la configuración del servidor. Los valores se obtienen, en orden creciente de precedencia, de los valores
+//por defecto, de un archivo de configuración (JSON), de variables de entorno y de los flags de "server start"
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Constantes
+const DEFAULT_CONFIG_FILE = "server.json" //Archivo de configuración que se lee si existe y no se especificó otro
+const ENVIRONMENT_PREFIX = "FILESHARING_" //Prefijo de las variables de entorno que configuran el servidor
+const ADMIN_TOKEN_MAX_LENGTH = 256        //Longitud máxima del token de administración
+
+//Modos de reenvío de archivos a los suscriptores
+const (
+	FORWARD_STORE    = "store"    //Recibir el archivo completo y luego enviarlo (store-then-forward)
+	FORWARD_PIPELINE = "pipeline" //Enviar a los suscriptores las partes del archivo conforme se reciben
+)
+
+//Configuración efectiva del servidor (se inicializa en main antes de aceptar conexiones)
+var config serverConfig
+
+type serverConfig struct {
+	BindAddress              string         `json:"bind_address"`               //Dirección sobre la que recibirá mensajes el servidor
+	ListenerPort             int            `json:"listener_port"`              //Puerto sobre el que recibirá mensajes el servidor
+	NumberOfChannels         int            `json:"number_of_channels"`         //Cantidad de canales numerados (1-N) que existen al iniciar
+	MaxChannels              int            `json:"max_channels"`               //Cantidad máxima de canales con nombre (0: sin límite)
+	BufferSize               int            `json:"buffer_size"`                //Tamaño de buffer temporal para recibir contenidos de mensaje largos (archivos)
+	FilenameMaxLength        int            `json:"filename_max_length"`        //Tamaño máximo del nombre de un archivo que se recibe
+	FanoutWorkers            int            `json:"fanout_workers"`             //Cantidad máxima de envíos simultáneos de un archivo a los suscriptores de un canal
+	DeliveryTimeout          configDuration `json:"delivery_timeout"`           //Tiempo máximo que un envío a un suscriptor puede pasar sin avanzar (0: sin límite)
+	SpoolDirectory           string         `json:"spool_directory"`            //Directorio donde se almacenan temporalmente los archivos recibidos
+	ForwardingMode           string         `json:"forwarding_mode"`            //Determina si un archivo se envía a los suscriptores luego de recibirlo completo o mientras se recibe
+	MaxFileSize              int64          `json:"max_file_size"`              //Tamaño máximo (bytes) de un archivo recibido (0: sin límite)
+	ChannelQuota             int64          `json:"channel_quota"`              //Bytes que pueden ocupar en el spool y en la cola los archivos de un canal (0: sin límite)
+	DataDirectory            string         `json:"data_directory"`             //Directorio donde se almacenan las suscripciones
+	SnapshotInterval         configDuration `json:"snapshot_interval"`          //Cada cuánto se escribe un snapshot de las suscripciones
+	QueueRetryDelay          configDuration `json:"queue_retry_delay"`          //Espera antes del primer reintento de un envío fallido (se duplica en cada intento)
+	QueueMaxRetryDelay       configDuration `json:"queue_max_retry_delay"`      //Espera máxima entre reintentos de un envío
+	QueueMaxAge              configDuration `json:"queue_max_age"`              //Antigüedad máxima de un envío pendiente antes de moverlo a dead-letter
+	ReceiptRetention         configDuration `json:"receipt_retention"`          //Tiempo durante el que se guardan los recibos de entrega
+	HealthCheckInterval      configDuration `json:"health_check_interval"`      //Cada cuánto se sondea a los suscriptores (0: sin sondeo)
+	HealthCheckTimeout       configDuration `json:"health_check_timeout"`       //Tiempo máximo de cada sondeo
+	EvictionThreshold        int            `json:"eviction_threshold"`         //Fallos consecutivos tras los que se elimina a un suscriptor (0: nunca)
+	ShutdownTimeout          configDuration `json:"shutdown_timeout"`           //Tiempo máximo que se espera a las transferencias en curso al apagar el servidor
+	AdminToken               string         `json:"admin_token"`                //Token requerido para consultar los suscriptores de un canal (vacío: consulta deshabilitada)
+	TLSCertFile              string         `json:"tls_cert_file"`              //Certificado (PEM) del listener (vacío: el listener no usa TLS)
+	TLSKeyFile               string         `json:"tls_key_file"`               //Llave privada (PEM) del certificado del listener
+	TLSClientCAFile          string         `json:"tls_client_ca_file"`         //CA (PEM) con la que se verifican los certificados de los clientes (vacío: no se piden certificados)
+	RequireClientCertificate bool           `json:"require_client_certificate"` //Indica si el listener rechaza a los clientes sin un certificado válido
+	ClientIdentity           string         `json:"client_identity"`            //Campo del certificado de cliente del que se obtiene su identidad (subject o san)
+	DeliveryTLS              bool           `json:"delivery_tls"`               //Indica si los envíos a los suscriptores usan TLS
+	DeliveryCAFile           string         `json:"delivery_ca_file"`           //CA (PEM) con la que se verifican los certificados de los suscriptores (vacío: CAs del sistema)
+	DeliveryTLSSkipVerify    bool           `json:"delivery_tls_skip_verify"`   //Indica si se omite la verificación de los certificados de los suscriptores (solo para pruebas)
+	SubscriberPolicy         string         `json:"subscriber_policy"`          //Política de direcciones de suscriptores (peer, allow-list u open)
+	SubscriberAllowList      string         `json:"subscriber_allow_list"`      //Redes (CIDR, separadas por comas) en las que se aceptan suscriptores
+	DenyInternalSubscribers  bool           `json:"deny_internal_subscribers"`  //Indica si se rechazan suscriptores con direcciones de loopback o link-local
+	CredentialsFile          string         `json:"credentials_file"`           //Archivo JSON con los tokens de los clientes ({"nombre": "token"}; vacío: sin autenticación)
+	ACLFile                  string         `json:"acl_file"`                   //Archivo JSON con las reglas de acceso de los canales (vacío: sin restricciones)
+}
+
+//Duración que en el archivo de configuración se escribe como texto (por ejemplo "30s")
+type configDuration struct {
+	time.Duration
+}
+
+func (d *configDuration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\"")
+	}
+	duration, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
+
+//Opción de configuración: su nombre se usa como flag, como variable de entorno (FILESHARING_ + nombre en mayúsculas)
+//y como llave del archivo de configuración (con "_" en lugar de "-")
+type configOption struct {
+	name        string
+	description string
+	field       func(c *serverConfig) interface{} //Retorna un puntero al campo correspondiente de la configuración
+}
+
+var configOptions = []configOption{
+	{"bind-address", "address on which the server listens", func(c *serverConfig) interface{} { return &c.BindAddress }},
+	{"listener-port", "port on which the server listens", func(c *serverConfig) interface{} { return &c.ListenerPort }},
+	{"number-of-channels", "number of numbered channels (1-N) created at startup (named channels are created on demand)", func(c *serverConfig) interface{} { return &c.NumberOfChannels }},
+	{"max-channels", "maximum number of named channels (0: no limit)", func(c *serverConfig) interface{} { return &c.MaxChannels }},
+	{"buffer-size", "size in bytes of the buffers used to transfer files", func(c *serverConfig) interface{} { return &c.BufferSize }},
+	{"filename-max-length", "size in bytes of the file name field", func(c *serverConfig) interface{} { return &c.FilenameMaxLength }},
+	{"fanout-workers", "maximum number of simultaneous deliveries of a file to a channel's subscribers", func(c *serverConfig) interface{} { return &c.FanoutWorkers }},
+	{"delivery-timeout", "maximum time a delivery to a subscriber may go without progress (0: no limit)", func(c *serverConfig) interface{} { return &c.DeliveryTimeout }},
+	{"spool-directory", "directory where received files are stored temporarily", func(c *serverConfig) interface{} { return &c.SpoolDirectory }},
+	{"forwarding-mode", "forwarding mode (" + FORWARD_STORE + " or " + FORWARD_PIPELINE + ")", func(c *serverConfig) interface{} { return &c.ForwardingMode }},
+	{"max-file-size", "maximum size in bytes of an uploaded file (0: no limit)", func(c *serverConfig) interface{} { return &c.MaxFileSize }},
+	{"channel-quota", "maximum bytes that a channel's files may occupy in the spool directory and the delivery queue (0: no limit)", func(c *serverConfig) interface{} { return &c.ChannelQuota }},
+	{"data-directory", "directory where subscriptions are persisted", func(c *serverConfig) interface{} { return &c.DataDirectory }},
+	{"snapshot-interval", "interval between snapshots of the subscriptions", func(c *serverConfig) interface{} { return &c.SnapshotInterval }},
+	{"queue-retry-delay", "delay before the first retry of a failed delivery (doubled on each attempt)", func(c *serverConfig) interface{} { return &c.QueueRetryDelay }},
+	{"queue-max-retry-delay", "maximum delay between retries of a failed delivery", func(c *serverConfig) interface{} { return &c.QueueMaxRetryDelay }},
+	{"queue-max-age", "maximum age of a queued delivery before it is moved to the dead-letter directory", func(c *serverConfig) interface{} { return &c.QueueMaxAge }},
+	{"receipt-retention", "time during which delivery receipts are kept", func(c *serverConfig) interface{} { return &c.ReceiptRetention }},
+	{"health-check-interval", "interval between subscriber health probes (0: no probes)", func(c *serverConfig) interface{} { return &c.HealthCheckInterval }},
+	{"health-check-timeout", "maximum duration of a subscriber health probe", func(c *serverConfig) interface{} { return &c.HealthCheckTimeout }},
+	{"eviction-threshold", "consecutive failures after which a subscriber is evicted and its pending deliveries are moved to dead-letter (0: never)", func(c *serverConfig) interface{} { return &c.EvictionThreshold }},
+	{"shutdown-timeout", "time to wait for in-flight transfers when shutting down", func(c *serverConfig) interface{} { return &c.ShutdownTimeout }},
+	{"admin-token", "token required to list a channel's subscribers (empty: the query is disabled)", func(c *serverConfig) interface{} { return &c.AdminToken }},
+	{"tls-cert-file", "PEM certificate of the listener (empty: no TLS)", func(c *serverConfig) interface{} { return &c.TLSCertFile }},
+	{"tls-key-file", "PEM private key of the listener's certificate", func(c *serverConfig) interface{} { return &c.TLSKeyFile }},
+	{"tls-client-ca-file", "PEM CA bundle used to verify clients' certificates (empty: client certificates are not requested)", func(c *serverConfig) interface{} { return &c.TLSClientCAFile }},
+	{"require-client-certificate", "reject clients without a valid certificate", func(c *serverConfig) interface{} { return &c.RequireClientCertificate }},
+	{"client-identity", "certificate field used as the client's identity (" + CLIENT_IDENTITY_SUBJECT + ": subject common name, " + CLIENT_IDENTITY_SAN + ": first DNS name, URI or email SAN)", func(c *serverConfig) interface{} { return &c.ClientIdentity }},
+	{"delivery-tls", "use TLS when connecting to subscribers to deliver files", func(c *serverConfig) interface{} { return &c.DeliveryTLS }},
+	{"delivery-ca-file", "PEM CA bundle used to verify subscribers' certificates (empty: system CAs)", func(c *serverConfig) interface{} { return &c.DeliveryCAFile }},
+	{"delivery-tls-skip-verify", "don't verify subscribers' certificates (testing only)", func(c *serverConfig) interface{} { return &c.DeliveryTLSSkipVerify }},
+	{"subscriber-policy", "subscriber address policy (" + SUBSCRIBER_POLICY_PEER + ": must match the client's IP or the allow-list, " + SUBSCRIBER_POLICY_ALLOW_LIST + ": must match the allow-list, " + SUBSCRIBER_POLICY_OPEN + ": any address)", func(c *serverConfig) interface{} { return &c.SubscriberPolicy }},
+	{"subscriber-allow-list", "comma-separated CIDR networks in which subscriber addresses are accepted", func(c *serverConfig) interface{} { return &c.SubscriberAllowList }},
+	{"deny-internal-subscribers", "reject subscriber addresses in loopback and link-local ranges", func(c *serverConfig) interface{} { return &c.DenyInternalSubscribers }},
+	{"credentials-file", "JSON file with the clients' tokens ({\"name\": \"token\"}; empty: no authentication)", func(c *serverConfig) interface{} { return &c.CredentialsFile }},
+	{"acl-file", "JSON file with the channels' access rules (empty: no restrictions; reloaded on SIGHUP)", func(c *serverConfig) interface{} { return &c.ACLFile }},
+}
+
+//Opciones cuyo valor no se imprime
+var secretOptions = map[string]bool{"admin-token": true}
+
+//Función que retorna la configuración por defecto
+func defaultConfig() serverConfig {
+	return serverConfig{
+		BindAddress:         "127.0.0.1",
+		ListenerPort:        7101,
+		NumberOfChannels:    8,
+		MaxChannels:         1024,
+		BufferSize:          1024,
+		FilenameMaxLength:   40,
+		FanoutWorkers:       16,
+		DeliveryTimeout:     configDuration{2 * time.Minute},
+		SpoolDirectory:      "spool",
+		ForwardingMode:      FORWARD_STORE,
+		DataDirectory:       "data",
+		SnapshotInterval:    configDuration{5 * time.Minute},
+		QueueRetryDelay:     configDuration{5 * time.Second},
+		QueueMaxRetryDelay:  configDuration{5 * time.Minute},
+		QueueMaxAge:         configDuration{24 * time.Hour},
+		ReceiptRetention:    configDuration{7 * 24 * time.Hour},
+		HealthCheckInterval: configDuration{time.Minute},
+		HealthCheckTimeout:  configDuration{5 * time.Second},
+		EvictionThreshold:   0,
+		ShutdownTimeout:     configDuration{30 * time.Second},
+		SubscriberPolicy:    SUBSCRIBER_POLICY_PEER,
+		ClientIdentity:      CLIENT_IDENTITY_SUBJECT,
+	}
+}
+
+//Función que obtiene la configuración a partir de los argumentos de "server start", el archivo de configuración y
+//las variables de entorno
+func loadConfig(arguments []string) (serverConfig, error) {
+	var c serverConfig = defaultConfig()
+	//Registrar los flags (sus valores se aplican al final para que tengan la mayor precedencia)
+	var flags *flag.FlagSet = flag.NewFlagSet("server start", flag.ContinueOnError)
+	var configPath string
+	var flagValues map[string]string = make(map[string]string)
+	flags.StringVar(&configPath, "config", "", "path of the JSON configuration file (default \""+DEFAULT_CONFIG_FILE+"\" if it exists)")
+	for _, option := range configOptions {
+		var name string = option.name
+		var record func(string) error = func(value string) error {
+			flagValues[name] = value
+			return nil
+		}
+		//Las opciones booleanas se pueden indicar sin valor ("-delivery-tls" equivale a "-delivery-tls=true")
+		if _, isBool := option.field(&c).(*bool); isBool {
+			flags.Var(boolFlag(record), name, option.description)
+		} else {
+			flags.Func(name, option.description, record)
+		}
+	}
+	if err := flags.Parse(arguments); err != nil {
+		return c, err
+	}
+	if flags.NArg() > 0 {
+		return c, errors.New("unexpected arguments: " + strings.Join(flags.Args(), " "))
+	}
+	//Leer el archivo de configuración
+	var explicitPath bool = true
+	if configPath == "" {
+		configPath = os.Getenv(ENVIRONMENT_PREFIX + "CONFIG")
+	}
+	if configPath == "" {
+		configPath = DEFAULT_CONFIG_FILE
+		explicitPath = false
+	}
+	if err := c.loadFile(configPath); err != nil {
+		if explicitPath || !errors.Is(err, os.ErrNotExist) {
+			return c, err
+		}
+	}
+	//Aplicar las variables de entorno
+	for _, option := range configOptions {
+		if value, found := os.LookupEnv(option.environmentName()); found {
+			if err := option.set(&c, value); err != nil {
+				return c, fmt.Errorf("environment variable %v: %w", option.environmentName(), err)
+			}
+		}
+	}
+	//Aplicar los flags
+	for _, option := range configOptions {
+		if value, found := flagValues[option.name]; found {
+			if err := option.set(&c, value); err != nil {
+				return c, fmt.Errorf("flag -%v: %w", option.name, err)
+			}
+		}
+	}
+	return c, c.validate()
+}
+
+//Función que sobrescribe la configuración con los valores presentes en un archivo JSON
+func (c *serverConfig) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var decoder *json.Decoder = json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("config file %v: %w", path, err)
+	}
+	return nil
+}
+
+//Función que valida los valores de la configuración
+func (c *serverConfig) validate() error {
+	if c.ListenerPort < 1 || c.ListenerPort > 65535 {
+		return fmt.Errorf("invalid listener port %d (allowed: 1-65535)", c.ListenerPort)
+	}
+	if c.NumberOfChannels < 0 || c.NumberOfChannels > 127 {
+		return fmt.Errorf("invalid number of channels %d (allowed: 0-127)", c.NumberOfChannels)
+	}
+	if c.MaxChannels < 0 {
+		return fmt.Errorf("invalid maximum number of channels %d", c.MaxChannels)
+	}
+	if c.BufferSize < 1 {
+		return fmt.Errorf("invalid buffer size %d", c.BufferSize)
+	}
+	if c.FilenameMaxLength < 1 {
+		return fmt.Errorf("invalid filename max length %d", c.FilenameMaxLength)
+	}
+	if c.FanoutWorkers < 1 {
+		return fmt.Errorf("invalid number of fan-out workers %d", c.FanoutWorkers)
+	}
+	if c.DeliveryTimeout.Duration < 0 {
+		return fmt.Errorf("invalid delivery timeout %v", c.DeliveryTimeout.Duration)
+	}
+	if c.SpoolDirectory == "" {
+		return errors.New("spool directory can't be empty")
+	}
+	if c.MaxFileSize < 0 {
+		return fmt.Errorf("invalid max file size %d", c.MaxFileSize)
+	}
+	if c.ChannelQuota < 0 {
+		return fmt.Errorf("invalid channel quota %d", c.ChannelQuota)
+	}
+	if c.DataDirectory == "" {
+		return errors.New("data directory can't be empty")
+	}
+	if c.SnapshotInterval.Duration <= 0 {
+		return fmt.Errorf("invalid snapshot interval %v", c.SnapshotInterval.Duration)
+	}
+	if c.QueueRetryDelay.Duration <= 0 || c.QueueMaxRetryDelay.Duration < c.QueueRetryDelay.Duration {
+		return fmt.Errorf("invalid queue retry delays (%v, max: %v)", c.QueueRetryDelay.Duration, c.QueueMaxRetryDelay.Duration)
+	}
+	if c.QueueMaxAge.Duration <= 0 {
+		return fmt.Errorf("invalid queue max age %v", c.QueueMaxAge.Duration)
+	}
+	if c.ReceiptRetention.Duration <= 0 {
+		return fmt.Errorf("invalid receipt retention %v", c.ReceiptRetention.Duration)
+	}
+	if c.HealthCheckInterval.Duration < 0 || c.HealthCheckTimeout.Duration <= 0 {
+		return fmt.Errorf("invalid health check interval/timeout (%v, %v)", c.HealthCheckInterval.Duration, c.HealthCheckTimeout.Duration)
+	}
+	if c.EvictionThreshold < 0 {
+		return fmt.Errorf("invalid eviction threshold %d", c.EvictionThreshold)
+	}
+	if c.ShutdownTimeout.Duration < 0 {
+		return fmt.Errorf("invalid shutdown timeout %v", c.ShutdownTimeout.Duration)
+	}
+	if err := c.validateTLS(); err != nil {
+		return err
+	}
+	if err := c.validateSubscriberPolicy(); err != nil {
+		return err
+	}
+	if len(c.AdminToken) > ADMIN_TOKEN_MAX_LENGTH {
+		return fmt.Errorf("admin token is too long (max: %d bytes)", ADMIN_TOKEN_MAX_LENGTH)
+	}
+	if c.ForwardingMode != FORWARD_STORE && c.ForwardingMode != FORWARD_PIPELINE {
+		return fmt.Errorf("invalid forwarding mode %q (allowed: %v, %v)", c.ForwardingMode, FORWARD_STORE, FORWARD_PIPELINE)
+	}
+	return nil
+}
+
+//Función que imprime la configuración efectiva
+func (c *serverConfig) print() {
+	fmt.Println("Effective configuration:")
+	for _, option := range configOptions {
+		var value interface{} = optionValue(option.field(c))
+		if secretOptions[option.name] && value != "" {
+			value = "(hidden)"
+		}
+		fmt.Printf("  %v = %v\n", option.name, value)
+	}
+}
+
+//Flag booleano cuyo valor se procesa con la función indicada
+type boolFlag func(string) error
+
+func (f boolFlag) String() string {
+	return ""
+}
+
+func (f boolFlag) Set(value string) error {
+	return f(value)
+}
+
+func (f boolFlag) IsBoolFlag() bool {
+	return true
+}
+
+//Función que retorna el nombre de la variable de entorno correspondiente a una opción
+func (o configOption) environmentName() string {
+	return ENVIRONMENT_PREFIX + strings.ToUpper(strings.ReplaceAll(o.name, "-", "_"))
+}
+
+//Función que asigna una opción a partir de su representación como texto
+func (o configOption) set(c *serverConfig, value string) error {
+	switch field := o.field(c).(type) {
+	case *string:
+		*field = value
+	case *int:
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		*field = number
+	case *int64:
+		number, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		*field = number
+	case *bool:
+		boolean, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		*field = boolean
+	case *configDuration:
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		field.Duration = duration
+	default:
+		return fmt.Errorf("unsupported option type %T", field)
+	}
+	return nil
+}
+
+//Función que retorna el valor apuntado por el puntero de una opción
+func optionValue(field interface{}) interface{} {
+	switch field := field.(type) {
+	case *string:
+		return *field
+	case *int:
+		return *field
+	case *int64:
+		return *field
+	case *bool:
+		return *field
+	case *configDuration:
+		return field.Duration
+	}
+	return field
+}
@@ -3,9 +3,13 @@ package main
 //Archivo con funciones relacionadas con el manejo de conexiones entrantes al servidor
 
 import (
+	"Server/protocol"
 	"bytes"
-	"encoding/binary"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net"
 	"os"
@@ -13,7 +17,7 @@ import (
 )
 
 //Función que maneja la recepción de comandos de los clientes, llamando las funciones correspondientes
-func handleConnection(connection net.Conn, subsMatrix *subscriptionMatrix) {
+func handleConnection(connection net.Conn, registry *channelRegistry) {
 	/*
 		Comandos existentes:
 		0: subscribe (solicitud de suscripción)
@@ -21,40 +25,132 @@ func handleConnection(connection net.Conn, subsMatrix *subscriptionMatrix) {
 		2: notify-success (notificar recepción/procesamiento exitoso de mensaje, no válido en este contexto)
 		3: notify-failure (notificar error durante recepción/procesamiento de mensaje, no válido en este contexto)
 		4: unsubscribe (solicitud para cancelar suscripción)
+		5: send-reported (solicitud de envío de archivo, respondiendo al final con el reporte de entrega)
+		6: report (reporte de entrega, no válido en este contexto)
+		7: receipt (consulta del reporte de entrega de una transferencia)
+		8: create-channel (creación explícita de un canal con nombre)
+		9: list-channels (consulta de los canales y su cantidad de suscriptores)
+		10: list-subscribers (consulta de los suscriptores de un canal, requiere el token de administración o un cliente
+			identificado con permiso para suscribirse al canal)
+		11: authenticate (token del cliente; el comando como tal se envía a continuación por la misma conexión)
+		12: digest (SHA-256 del archivo de un mensaje send, que se envía a continuación por la misma conexión)
+		13: delete-channel (eliminación de un canal con nombre sin suscriptores)
 	*/
-	var exitStatus int = -1                    //Código que indica el resultado de procesar la conexión actual
-	var commandBuffer []byte = make([]byte, 1) //Buffer que recibe el comando inicial
-	//Leer el comando recibido (la idea es que sea uno de los permitidos en el protocolo)
-	_, messageError := connection.Read(commandBuffer)
-	//Error check
-	if messageError != nil {
-		fmt.Println("ERROR: Error while reading client's command: " + messageError.Error())
-		_, err := connection.Write(createSimpleMessage(3, 0, []byte("command read error")))
+	var exitStatus int = -1 //Código que indica el resultado de procesar la conexión actual
+	//Registrar la conexión como transferencia en curso (para que un apagado ordenado espere a que termine)
+	var clientDescription string = connection.RemoteAddr().String()
+	transferID, accepted := transfers.begin("connection from "+clientDescription, connection)
+	if !accepted {
+		connection.Close()
+		return
+	}
+	defer transfers.end(transferID)
+	//Leer el header del mensaje recibido (la idea es que el comando sea uno de los permitidos en el protocolo)
+	var decoder *protocol.Decoder = protocol.NewDecoder(connection)
+	header, exitStatus, headerOk := processHeader(connection, decoder)
+	//Identificar al cliente por su certificado, si presentó uno (el handshake TLS ya ocurrió al leer el header)
+	var identity string = connectionIdentity(connection)
+	if identity != "" {
+		fmt.Printf("Client %v identified by certificate as %v\n", clientDescription, identity)
+	}
+	//Procesar los mensajes previos al comando como tal (cada uno a lo sumo una vez): authenticate, cuya identidad
+	//reemplaza a la del certificado, y digest, que indica el digest del archivo que se enviará
+	var authenticated bool = false
+	var digest []byte
+	for headerOk && ((header.Command == protocol.COMMAND_AUTHENTICATE && !authenticated) || (header.Command == protocol.COMMAND_DIGEST && digest == nil)) {
+		if header.Command == protocol.COMMAND_AUTHENTICATE {
+			identity, exitStatus = processAuthentication(connection, decoder, header)
+			authenticated = true
+		} else {
+			digest, exitStatus = processDigest(connection, decoder, header)
+		}
+		headerOk = exitStatus == 0
+		if headerOk {
+			header, exitStatus, headerOk = processHeader(connection, decoder)
+		}
+	}
+	if !headerOk {
+		connection.Close()
+		fmt.Printf("Handled connection (status: %d)\n", exitStatus)
+		return
+	}
+	//El digest solo tiene sentido antes de un envío de archivo
+	if digest != nil && header.Command != protocol.COMMAND_SEND && header.Command != protocol.COMMAND_SEND_REPORTED {
+		fmt.Println("ERROR: The client sent a digest before a command that doesn't send a file")
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte("digest is only allowed before a send command")))
 		if err != nil {
 			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
 		}
-		exitStatus = 2
-		fmt.Printf("Handled connection (status: %d)\n", exitStatus)
+		connection.Close()
+		fmt.Printf("Handled connection (status: %d)\n", 3)
 		return
 	}
+	//Los comandos que operan sobre los canales, las suscripciones o los archivos requieren autenticación (si está
+	//habilitada). list-subscribers acepta además el token de administración
+	if credentials != nil && identity == "" && requiresAuthentication(header.Command) {
+		fmt.Println("ERROR: Unauthenticated request from " + clientDescription)
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte("authentication required")))
+		if err != nil {
+			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+		}
+		connection.Close()
+		fmt.Printf("Handled connection (status: %d)\n", 3)
+		return
+	}
+	//Obtener el canal al que se dirige el mensaje (los demás comandos no operan sobre un canal)
+	var channel string
+	switch header.Command {
+	case protocol.COMMAND_SUBSCRIBE, protocol.COMMAND_SEND, protocol.COMMAND_SEND_REPORTED, protocol.COMMAND_UNSUBSCRIBE,
+		protocol.COMMAND_CREATE_CHANNEL, protocol.COMMAND_DELETE_CHANNEL, protocol.COMMAND_LIST_SUBSCRIBERS:
+		channel, exitStatus = processChannel(connection, decoder, &header)
+		if exitStatus != 0 {
+			connection.Close()
+			fmt.Printf("Handled connection (status: %d)\n", exitStatus)
+			return
+		}
+	}
 
-	//Parsear el comando recibido
-	var command int8
-	command = int8(commandBuffer[0])
-
-	switch command {
-	case 0:
+	switch header.Command {
+	case protocol.COMMAND_SUBSCRIBE:
 		//Suscripción a canal
 		fmt.Println("Command received: subscribe")
-		exitStatus = processSubscription(connection, subsMatrix)
-	case 1:
+		transfers.describe(transferID, "subscription request from "+clientDescription)
+		exitStatus = processSubscription(connection, decoder, header, channel, identity, registry)
+	case protocol.COMMAND_SEND, protocol.COMMAND_SEND_REPORTED:
 		//Envío de archivo
 		fmt.Println("Command received: send")
-		exitStatus = processFileSharing(connection, subsMatrix)
-	case 4:
+		transfers.describe(transferID, fmt.Sprintf("upload to channel %v from %v", channel, clientDescription))
+		exitStatus = processFileSharing(connection, decoder, header, channel, identity, digest, registry)
+	case protocol.COMMAND_UNSUBSCRIBE:
 		//Cancelación de suscripción
 		fmt.Println("Command received: unsubscribe")
-		exitStatus = cancelSubscription(connection, subsMatrix)
+		transfers.describe(transferID, "unsubscription request from "+clientDescription)
+		exitStatus = cancelSubscription(connection, decoder, header, channel, identity, registry)
+	case protocol.COMMAND_RECEIPT:
+		//Consulta de recibo de entrega
+		fmt.Println("Command received: receipt")
+		transfers.describe(transferID, "receipt query from "+clientDescription)
+		exitStatus = processReceiptQuery(connection, decoder, header)
+	case protocol.COMMAND_CREATE_CHANNEL:
+		//Creación de canal
+		fmt.Println("Command received: create-channel")
+		transfers.describe(transferID, "channel creation request from "+clientDescription)
+		exitStatus = processChannelCreation(connection, header, channel, identity, registry)
+	case protocol.COMMAND_DELETE_CHANNEL:
+		//Eliminación de canal
+		fmt.Println("Command received: delete-channel")
+		transfers.describe(transferID, "channel deletion request from "+clientDescription)
+		exitStatus = processChannelDeletion(connection, header, channel, identity, registry)
+	case protocol.COMMAND_LIST_CHANNELS:
+		//Consulta de canales
+		fmt.Println("Command received: list-channels")
+		transfers.describe(transferID, "channel list query from "+clientDescription)
+		exitStatus = processChannelListing(connection, header, registry)
+	case protocol.COMMAND_LIST_SUBSCRIBERS:
+		//Consulta de suscriptores
+		fmt.Println("Command received: list-subscribers")
+		transfers.describe(transferID, "subscriber list query from "+clientDescription)
+		exitStatus = processSubscriberListing(connection, decoder, header, channel, identity, registry)
 	default:
 		//Comando inválido
 		fmt.Println("Received invalid command. Closing connection...")
@@ -68,22 +164,53 @@ func handleConnection(connection net.Conn, subsMatrix *subscriptionMatrix) {
 	fmt.Printf("Handled connection (status: %d)\n", exitStatus)
 }
 
-//Función para procesar una solicitud de suscripción de un cliente a un canal
-func processSubscription(connection net.Conn, subsMatrix *subscriptionMatrix) int {
-	var channel int8
+//Función para procesar una solicitud de suscripción de un cliente (con la identidad indicada) a un canal
+func processSubscription(connection net.Conn, decoder *protocol.Decoder, header protocol.Header, channel string, identity string, registry *channelRegistry) int {
 	var clientAddress string
+	var options protocol.SubscribeOptions
 	var processStatus int
 	//Cerrar la conexión al terminar
 	defer connection.Close()
-	channel, clientAddress, processStatus = processSubscriptionMessage(connection)
+	clientAddress, options, processStatus = processSubscriptionMessage(connection, decoder, header)
 	if processStatus != 0 {
 		return processStatus
 	}
-	//Añadir la nueva dirección a la matriz de suscripciones
-	subsMatrix.append(clientAddress, channel)
-	fmt.Printf("New client subscribed to channel %d (%v)\n", channel, clientAddress)
+	//Comprobar que la dirección cumpla la política de suscriptores (el servidor se conectará a ella)
+	if policyError := checkSubscriberAddress(clientAddress, connection.RemoteAddr()); policyError != nil {
+		fmt.Printf("ERROR: Rejected subscription of %v from %v: %v\n", clientAddress, connection.RemoteAddr(), policyError)
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte(policyError.Error())))
+		if err != nil {
+			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+		}
+		return 3
+	}
+	//Comprobar que la identidad del cliente pueda suscribirse al canal
+	if !accessRules.allows(identity, channel, ACL_SUBSCRIBE) {
+		fmt.Printf("ERROR: Client %v (%v) is not allowed to subscribe to channel %v\n", connection.RemoteAddr(), describeIdentity(identity), channel)
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte("not allowed to subscribe to channel")))
+		if err != nil {
+			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+		}
+		return 3
+	}
+	//Añadir la nueva dirección al canal, creándolo si no existe (si ya estaba suscrita se renueva su lease)
+	lease, _ := options.LeaseDuration()
+	//Si el cliente se identificó con un certificado, al recibir los archivos debe presentar uno con la misma identidad
+	if appendError := registry.append(clientAddress, channel, subscription{owner: identity, certificate: connectionIdentity(connection), filter: options.Filter, digest: options.Digest}, lease); appendError != nil {
+		fmt.Printf("ERROR: Rejected subscription of %v to channel %v (%v): %v\n", clientAddress, channel, describeIdentity(identity), appendError)
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte(appendError.Error())))
+		if err != nil {
+			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+		}
+		return 3
+	}
+	if lease > 0 {
+		fmt.Printf("New client subscribed to channel %v (%v, lease: %v)\n", channel, clientAddress, lease)
+	} else {
+		fmt.Printf("New client subscribed to channel %v (%v)\n", channel, clientAddress)
+	}
 	//Retornar un mensaje al cliente
-	_, err := connection.Write(createSimpleMessage(2, channel, []byte("subscribed")))
+	_, err := connection.Write(createSimpleMessage(2, header.Channel, []byte("subscribed")))
 	if err != nil {
 		fmt.Println("ERROR: Error while sending response to client: " + err.Error())
 		return 2
@@ -91,22 +218,38 @@ func processSubscription(connection net.Conn, subsMatrix *subscriptionMatrix) in
 	return 0
 }
 
-//Función para procesar una solicitud de cancelación de suscripción de un canal
-func cancelSubscription(connection net.Conn, subsMatrix *subscriptionMatrix) int {
-	var channel int8
+//Función para procesar una solicitud de cancelación de suscripción de un canal (solo se puede cancelar una suscripción
+//creada por la misma identidad)
+func cancelSubscription(connection net.Conn, decoder *protocol.Decoder, header protocol.Header, channel string, identity string, registry *channelRegistry) int {
 	var clientAddress string
 	var processStatus int
 	//Cerrar la conexión al terminar
 	defer connection.Close()
-	channel, clientAddress, processStatus = processSubscriptionMessage(connection)
+	clientAddress, _, processStatus = processSubscriptionMessage(connection, decoder, header)
 	if processStatus != 0 {
 		return processStatus
 	}
-	//Añadir la nueva dirección a la matriz de suscripciones
-	subsMatrix.removeSubscriptor(clientAddress, channel)
-	fmt.Printf("Client %v unsubscribed from channel %d\n", clientAddress, channel)
+	//Comprobar que la identidad del cliente pueda suscribirse al canal (y, por lo tanto, cancelar sus suscripciones)
+	if !accessRules.allows(identity, channel, ACL_SUBSCRIBE) {
+		fmt.Printf("ERROR: Client %v (%v) is not allowed to unsubscribe from channel %v\n", connection.RemoteAddr(), describeIdentity(identity), channel)
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte("not allowed to unsubscribe from channel")))
+		if err != nil {
+			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+		}
+		return 3
+	}
+	//Retirar la dirección del canal (cancelar una suscripción inexistente no es un error)
+	if cancelError := registry.cancel(clientAddress, channel, identity); cancelError != nil && !errors.Is(cancelError, errNotSubscribed) {
+		fmt.Printf("ERROR: Rejected unsubscription of %v from channel %v (%v): %v\n", clientAddress, channel, describeIdentity(identity), cancelError)
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte(cancelError.Error())))
+		if err != nil {
+			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+		}
+		return 3
+	}
+	fmt.Printf("Client %v unsubscribed from channel %v\n", clientAddress, channel)
 	//Retornar un mensaje al cliente
-	_, err := connection.Write(createSimpleMessage(2, channel, []byte("unsubscribed")))
+	_, err := connection.Write(createSimpleMessage(2, header.Channel, []byte("unsubscribed")))
 	if err != nil {
 		fmt.Println("ERROR: Error while sending response to client: " + err.Error())
 		return 2
@@ -114,39 +257,227 @@ func cancelSubscription(connection net.Conn, subsMatrix *subscriptionMatrix) int
 	return 0
 }
 
-//Función para procesar una solicitud de envío de archivo de un cliente a un canal
-func processFileSharing(connection net.Conn, subsMatrix *subscriptionMatrix) int {
-	var channelBuffer []byte = make([]byte, 1)                    //Buffer que recibe el canal por el que se enviará el archivo
-	var lengthBuffer []byte = make([]byte, 8)                     //Buffer que recibe la longitud del contenido (nombre y contenido de archivo)
-	var filenameBuffer []byte = make([]byte, FILENAME_MAX_LENGTH) //Buffer que recibe el nombre del archivo
-	var fileBuffer []byte                                         //Buffer que recibe el contenido del archivo
-	var tempBuffer []byte                                         //Buffer que va leyendo el contenido del archivo en partes
+//Función para procesar una solicitud de creación de un canal con nombre de un cliente (con la identidad indicada), que
+//debe tener permiso para enviar archivos al canal
+func processChannelCreation(connection net.Conn, header protocol.Header, channel string, identity string, registry *channelRegistry) int {
 	//Cerrar la conexión al terminar
 	defer connection.Close()
-	//Leer el canal seleccionado por el cliente
-	_, channelError := connection.Read(channelBuffer)
+	//El mensaje solo contiene el nombre del canal
+	if header.Length != 0 {
+		fmt.Println("ERROR: The client's message specified an invalid content length")
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte("invalid content length")))
+		if err != nil {
+			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+		}
+		return 3
+	}
+	//Verificar que el cliente pueda modificar el canal
+	if !accessRules.allows(identity, channel, ACL_PUBLISH) {
+		fmt.Printf("ERROR: Client %v (%v) is not allowed to create channel %v\n", connection.RemoteAddr(), describeIdentity(identity), channel)
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte("not allowed to create channel")))
+		if err != nil {
+			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+		}
+		return 3
+	}
+	//Crear el canal (si ya existe no se modifica)
+	var response string = "already exists"
+	created, createError := registry.create(channel)
 	//Error check
-	if channelError != nil {
-		fmt.Println("ERROR: Error while reading client's selected channel: " + channelError.Error())
-		_, err := connection.Write(createSimpleMessage(3, 0, []byte("channel read error")))
+	if createError != nil {
+		fmt.Printf("ERROR: Could not create channel %v: %v\n", channel, createError)
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte(createError.Error())))
 		if err != nil {
 			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
 		}
+		return 3
+	}
+	if created {
+		fmt.Printf("Created channel %v\n", channel)
+		response = "created"
+	}
+	//Retornar un mensaje al cliente
+	_, err := connection.Write(createSimpleMessage(2, header.Channel, []byte(response)))
+	if err != nil {
+		fmt.Println("ERROR: Error while sending response to client: " + err.Error())
 		return 2
 	}
-	//Leer la longitud del contenido en el mensaje
-	_, lengthError := connection.Read(lengthBuffer)
+	return 0
+}
+
+//Función para procesar una solicitud de eliminación de un canal de un cliente (con la identidad indicada). Solo se
+//eliminan canales con nombre sin suscriptores, y el cliente debe tener permiso para enviar archivos al canal
+func processChannelDeletion(connection net.Conn, header protocol.Header, channel string, identity string, registry *channelRegistry) int {
+	//Cerrar la conexión al terminar
+	defer connection.Close()
+	//El mensaje solo contiene el nombre del canal
+	if header.Length != 0 {
+		fmt.Println("ERROR: The client's message specified an invalid content length")
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte("invalid content length")))
+		if err != nil {
+			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+		}
+		return 3
+	}
+	//Verificar que el cliente pueda modificar el canal
+	var deleteError error
+	if !accessRules.allows(identity, channel, ACL_PUBLISH) {
+		deleteError = errors.New("not allowed to delete channel")
+	} else {
+		deleteError = registry.deleteChannel(channel)
+	}
 	//Error check
-	if lengthError != nil {
-		fmt.Println("ERROR: Error while reading message's content length: " + lengthError.Error())
-		_, err := connection.Write(createSimpleMessage(3, 0, []byte("length read error")))
+	if deleteError != nil {
+		fmt.Printf("ERROR: Could not delete channel %v (%v): %v\n", channel, describeIdentity(identity), deleteError)
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte(deleteError.Error())))
+		if err != nil {
+			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+		}
+		return 3
+	}
+	fmt.Printf("Deleted channel %v\n", channel)
+	//Retornar un mensaje al cliente
+	_, err := connection.Write(createSimpleMessage(2, header.Channel, []byte("deleted")))
+	if err != nil {
+		fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+		return 2
+	}
+	return 0
+}
+
+//Función para procesar una consulta de la lista de canales
+func processChannelListing(connection net.Conn, header protocol.Header, registry *channelRegistry) int {
+	//Cerrar la conexión al terminar
+	defer connection.Close()
+	//El mensaje no tiene contenido
+	if header.Length != 0 {
+		fmt.Println("ERROR: The client's message specified an invalid content length")
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte("invalid content length")))
+		if err != nil {
+			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+		}
+		return 3
+	}
+	listBody, listError := json.Marshal(protocol.ChannelList{Channels: registry.describeChannels()})
+	if listError == nil {
+		_, listError = connection.Write(createSimpleMessage(2, 0, listBody))
+	}
+	if listError != nil {
+		fmt.Println("ERROR: Error while sending channel list to client: " + listError.Error())
+		return 2
+	}
+	return 0
+}
+
+//Función para procesar una consulta de los suscriptores de un canal (solo para clientes con el token de administración
+//o identificados con la identidad indicada, si pueden suscribirse al canal)
+func processSubscriberListing(connection net.Conn, decoder *protocol.Decoder, header protocol.Header, channel string, identity string, registry *channelRegistry) int {
+	//Cerrar la conexión al terminar
+	defer connection.Close()
+	//Leer el token de administración
+	if header.Length > ADMIN_TOKEN_MAX_LENGTH {
+		fmt.Println("ERROR: The client's message specified an invalid content length")
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte("invalid content length")))
+		if err != nil {
+			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+		}
+		return 3
+	}
+	var tokenBuffer []byte = make([]byte, header.Length)
+	if tokenError := decoder.ReadField("token", tokenBuffer); tokenError != nil {
+		fmt.Println("ERROR: Error while reading message's content: " + tokenError.Error())
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte(decodeErrorReason(tokenError))))
+		if err != nil {
+			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+		}
+		return 2
+	}
+	//Se acepta el token de administración o un cliente identificado (por su token o su certificado) que pueda
+	//suscribirse al canal
+	if !isAdminToken(tokenBuffer) && (identity == "" || !accessRules.allows(identity, channel, ACL_SUBSCRIBE)) {
+		fmt.Println("ERROR: Unauthorized subscriber list query from " + connection.RemoteAddr().String())
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte("unauthorized")))
+		if err != nil {
+			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+		}
+		return 3
+	}
+	//Obtener los suscriptores
+	subscribers, found := registry.describeSubscribers(channel)
+	if !found {
+		fmt.Println("ERROR: The client's message specified an unknown channel: " + channel)
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte("unknown channel")))
+		if err != nil {
+			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+		}
+		return 3
+	}
+	listBody, listError := json.Marshal(protocol.SubscriberList{Channel: channel, Subscribers: subscribers})
+	if listError == nil {
+		_, listError = connection.Write(createSimpleMessage(2, header.Channel, listBody))
+	}
+	if listError != nil {
+		fmt.Println("ERROR: Error while sending subscriber list to client: " + listError.Error())
+		return 2
+	}
+	return 0
+}
+
+//Función para procesar una consulta del recibo de entrega de una transferencia
+func processReceiptQuery(connection net.Conn, decoder *protocol.Decoder, header protocol.Header) int {
+	//Cerrar la conexión al terminar
+	defer connection.Close()
+	//Leer el ID de transferencia consultado
+	if header.Length <= 0 || header.Length > 2*TRANSFER_ID_LENGTH {
+		fmt.Println("ERROR: The client's message specified an invalid content length")
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte("invalid content length")))
+		if err != nil {
+			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+		}
+		return 3
+	}
+	var idBuffer []byte = make([]byte, header.Length)
+	if idError := decoder.ReadField("content", idBuffer); idError != nil {
+		fmt.Println("ERROR: Error while reading message's content: " + idError.Error())
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte(decodeErrorReason(idError))))
 		if err != nil {
 			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
 		}
 		return 2
 	}
+	//Buscar el recibo
+	report, receiptError := receipts.load(string(idBuffer))
+	if receiptError != nil {
+		fmt.Println("ERROR: Could not load delivery receipt: " + receiptError.Error())
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte(receiptError.Error())))
+		if err != nil {
+			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+		}
+		return 3
+	}
+	reportBody, reportError := json.Marshal(report)
+	if reportError == nil {
+		_, reportError = connection.Write(createSimpleMessage(protocol.COMMAND_REPORT, channelNumber(report.Channel), reportBody))
+	}
+	if reportError != nil {
+		fmt.Println("ERROR: Error while sending delivery receipt to client: " + reportError.Error())
+		return 2
+	}
+	return 0
+}
+
+//Función para procesar una solicitud de envío de archivo de un cliente (con la identidad indicada) a un canal. El
+//servidor calcula el digest del contenido conforme lo recibe; si el cliente indicó el digest del archivo (digest no
+//nil), se comprueba que el contenido recibido corresponda a él
+func processFileSharing(connection net.Conn, decoder *protocol.Decoder, header protocol.Header, channel string, identity string, digest []byte, registry *channelRegistry) int {
+	var filenameBuffer []byte = make([]byte, config.FilenameMaxLength) //Buffer que recibe el nombre del archivo
+	var tempBuffer []byte                                              //Buffer que va leyendo el contenido del archivo en partes
+	var fileReader io.Reader                                           //Reader limitado al contenido del archivo
+	var spool *os.File                                                 //Archivo temporal donde se almacena el contenido recibido
+	//Cerrar la conexión al terminar
+	defer connection.Close()
 	//Leer el nombre del archivo
-	_, filenameError := connection.Read(filenameBuffer)
+	filenameError := decoder.ReadField("filename", filenameBuffer)
 	//Error check
 	if filenameError != nil {
 		fmt.Println("ERROR: Error while reading file name: " + filenameError.Error())
@@ -156,23 +487,27 @@ func processFileSharing(connection net.Conn, subsMatrix *subscriptionMatrix) int
 		}
 		return 2
 	}
-	//Parsear el canal recibido
-	var channel int8
-	channel = int8(channelBuffer[0])
-	//Comprobar que el canal recibido sea válido
-	if channel < 1 || channel > NUMBER_OF_CHANNELS {
-		fmt.Println("ERROR: The client's message specified an invalid channel")
-		_, err := connection.Write(createSimpleMessage(3, 0, []byte("invalid channel")))
+	//Comprobar que la identidad del cliente pueda enviar archivos al canal
+	if !accessRules.allows(identity, channel, ACL_PUBLISH) {
+		fmt.Printf("ERROR: Client %v (%v) is not allowed to send to channel %v\n", connection.RemoteAddr(), describeIdentity(identity), channel)
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte("not allowed to send to channel")))
+		if err != nil {
+			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+		}
+		return 3
+	}
+	//Comprobar que el canal recibido exista (o que algún patrón de las suscripciones coincida con él)
+	if !registry.accepts(channel) {
+		fmt.Println("ERROR: The client's message specified an unknown channel: " + channel)
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte("unknown channel")))
 		if err != nil {
 			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
 		}
 		return 3
 	}
-	//Parsear la longitud del contenido
-	var contentLength int64
-	contentLength = int64(binary.LittleEndian.Uint64(lengthBuffer))
 	//Comprobar que la longitud sea válida
-	if contentLength <= FILENAME_MAX_LENGTH {
+	var contentLength int64 = header.Length
+	if contentLength <= int64(config.FilenameMaxLength) {
 		fmt.Println("ERROR: The client's message specified an invalid content length")
 		_, err := connection.Write(createSimpleMessage(3, 0, []byte("invalid content length")))
 		if err != nil {
@@ -191,157 +526,305 @@ func processFileSharing(connection net.Conn, subsMatrix *subscriptionMatrix) int
 		}
 		return 3
 	}
+	//Comprobar que el archivo no exceda el tamaño máximo (antes de leer su contenido)
+	var fileSize int64 = contentLength - int64(config.FilenameMaxLength)
+	if config.MaxFileSize > 0 && fileSize > config.MaxFileSize {
+		fmt.Printf("ERROR: The client's file exceeds the maximum file size (%d bytes, max: %d)\n", fileSize, config.MaxFileSize)
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte(fmt.Sprintf("file too large (max: %d bytes)", config.MaxFileSize))))
+		if err != nil {
+			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+		}
+		return 3
+	}
+	//Reservar el tamaño del archivo en la cuota del canal
+	if !spoolUsage.reserve(channel, fileSize, config.ChannelQuota) {
+		fmt.Printf("ERROR: The client's file exceeds the quota of channel %v (%d bytes, quota: %d)\n", channel, fileSize, config.ChannelQuota)
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte(fmt.Sprintf("channel quota exceeded (quota: %d bytes)", config.ChannelQuota))))
+		if err != nil {
+			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+		}
+		return 3
+	}
 	fmt.Printf("Receiving file \"%v\"...\n", filename)
-	//Leer el resto del mensaje (contenido del archivo)
-	fileBuffer = make([]byte, 0) //Este buffer empieza vacío, pues se le irá concatenando el contenido del temporal
-	tempBuffer = make([]byte, BUFFER_SIZE)
-	var readLength int64 = 0
-	//Lectura por partes para evitar problemas con archivos grandes
-	for {
-		//Leer al buffer temporal
-		n, fileError := connection.Read(tempBuffer)
-		//Error check
-		if fileError == io.EOF { //Se concluyó la lectura
-			break
-		} else if fileError != nil { //Hubo un error de otro tipo
-			fmt.Println("ERROR: Error while reading file content: " + fileError.Error())
-			_, err := connection.Write(createSimpleMessage(3, 0, []byte("file read error")))
-			if err != nil {
-				fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+	//Crear el archivo temporal en el que se almacenará el contenido conforme llegue
+	spool, spoolError := createSpoolFile()
+	//Error check
+	if spoolError != nil {
+		spoolUsage.release(channel, fileSize)
+		fmt.Println("ERROR: Error while creating spool file: " + spoolError.Error())
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte("server storage error")))
+		if err != nil {
+			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+		}
+		return 2
+	}
+	var file *spooledFile = &spooledFile{path: spool.Name(), transferID: newTransferID(), name: filename, filename: filenameBuffer, channel: channel, size: fileSize}
+	//Eliminar el archivo temporal al terminar (una vez que terminen los envíos en curso)
+	var fan *fanout
+	defer file.remove()
+	defer func() {
+		if fan != nil {
+			fan.wait()
+		}
+	}()
+	var spoolOutput io.Writer = spool
+	if config.ForwardingMode == FORWARD_PIPELINE {
+		//En modo pipeline los envíos empiezan antes de recibir el archivo y lo leen del spool conforme se escribe,
+		//de manera que un suscriptor lento no detiene al cliente que envía ni a los demás suscriptores
+		//Si el cliente indicó el digest, la última parte del archivo no se entrega hasta comprobarlo, para que los
+		//suscriptores nunca reciban completo un contenido que no corresponde a su digest
+		var held int64 = -1
+		if digest != nil {
+			held = file.size - int64(config.BufferSize)
+			if held < 0 {
+				held = 0
 			}
-			return 2
 		}
-		//Añadir lo leído al buffer del archivo
-		fileBuffer = append(fileBuffer, tempBuffer[:n]...)
-		//Actualizar la longitud leída
-		readLength += int64(n)
-		//Si ya se leyó el archivo completamente, se sale del bucle
-		if readLength == contentLength-FILENAME_MAX_LENGTH {
-			break
+		file.progress = newSpoolProgress(held)
+		spoolOutput = &spoolWriter{file: spool, progress: file.progress}
+		var clientList []recipient = registry.recipients(channel)
+		fmt.Printf("Forwarding incoming file to clients subscribed to channel %v (%d clients):\n", channel, len(clientList))
+		fan = startFanout(file, clientList)
+	}
+	//Calcular el digest del contenido conforme se recibe (para comprobarlo y para los suscriptores que lo piden)
+	var hasher hash.Hash = sha256.New()
+	spoolOutput = io.MultiWriter(spoolOutput, hasher)
+	//Leer el resto del mensaje (contenido del archivo) por partes, escribiéndolo en el archivo temporal
+	tempBuffer = make([]byte, config.BufferSize)
+	fileReader = decoder.Body(file.size)
+	readLength, fileError := io.CopyBuffer(spoolOutput, fileReader, tempBuffer)
+	closeError := spool.Close()
+	//Error check
+	if fileError == nil && closeError != nil {
+		fileError = closeError
+	}
+	//Comprobar que el contenido recibido corresponda al digest indicado por el cliente. El digest se guarda antes de
+	//notificar el fin de la recepción para que los envíos en curso lo tengan al terminar de leer el contenido
+	var digestError error
+	file.digest = hasher.Sum(nil)
+	if fileError == nil && readLength == file.size && digest != nil && !bytes.Equal(file.digest, digest) {
+		digestError = errDigestMismatch
+	}
+	if file.progress != nil {
+		//Notificar a los envíos en curso que terminó la recepción (con error si el archivo no llegó completo o no
+		//corresponde a su digest)
+		if fileError == nil && readLength != file.size {
+			file.progress.finish(io.ErrUnexpectedEOF)
+		} else if digestError != nil {
+			file.progress.finish(digestError)
+		} else {
+			file.progress.finish(fileError)
+		}
+	}
+	if fileError != nil {
+		fmt.Println("ERROR: Error while receiving file content: " + fileError.Error())
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte("file read error")))
+		if err != nil {
+			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
 		}
+		return 2
 	}
-
-	if readLength != contentLength-FILENAME_MAX_LENGTH {
-		fmt.Printf("ERROR: Could not read file content completely (expected: %d, real: %d)\n", contentLength-FILENAME_MAX_LENGTH, readLength)
+	if readLength != file.size {
+		fmt.Printf("ERROR: Could not read file content completely (expected: %d, real: %d)\n", file.size, readLength)
 		_, err := connection.Write(createSimpleMessage(3, 0, []byte("file incomplete read")))
 		if err != nil {
 			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
 		}
 		return 2
 	}
-	//El archivo se ha leído y se tiene en un buffer
-	fmt.Printf("File received from client (%v, %d bytes)\n", filename, contentLength-FILENAME_MAX_LENGTH)
+	if digestError != nil {
+		fmt.Printf("ERROR: The content of file \"%v\" doesn't match its digest (expected: %x, real: %x)\n", filename, digest, file.digest)
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte(digestError.Error())))
+		if err != nil {
+			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+		}
+		return 3
+	}
+	//El archivo se ha leído y se tiene almacenado en disco
+	fmt.Printf("File received from client (%v, %d bytes)\n", filename, file.size)
 	//Comunicar que se recibió el archivo al cliente que lo envió
-	_, err := connection.Write(createSimpleMessage(2, channel, []byte("received")))
+	//(junto con el ID de transferencia, que permite consultar después el recibo de entrega)
+	_, err := connection.Write(createSimpleMessage(2, header.Channel, []byte("received "+file.transferID)))
 	if err != nil {
 		fmt.Println("ERROR: Error while sending response to client: " + err.Error())
 		return 2
 	}
-	//El archivo se enviará a los clientes suscritos al canal. Primero se armará el mensaje (longitud, filename, file)
-	var message []byte = createSimpleMessage(1, channel, append(filenameBuffer, fileBuffer...))
-	//Se debe obtener la lista actual de clientes suscritos al canal recibido
-	var clientList []string = subsMatrix.readChannel(channel)
-	//Iniciar envío de archivos a cada cliente suscrito
-	fmt.Printf("Sending received file to clients subscribed to channel %d (%d clients):\n", channel, len(clientList))
-	for i, clientAddress := range clientList {
-		fmt.Printf("(%d/%d) Sending file to client %v...\n", i+1, len(clientList), clientAddress)
-		if SEND_FILES_CONCURRENTLY {
-			go sendFileToClient(message, fileBuffer, clientAddress) //Envío concurrente
-		} else {
-			sendFileToClient(message, fileBuffer, clientAddress) //Envío secuencial
+	if fan == nil {
+		//Se debe obtener la lista actual de clientes suscritos al canal recibido (directamente o mediante un patrón)
+		var clientList []recipient = registry.recipients(channel)
+		//Iniciar envío de archivos a cada cliente suscrito
+		fmt.Printf("Sending received file to clients subscribed to channel %v (%d clients):\n", channel, len(clientList))
+		fan = startFanout(file, clientList)
+	}
+	//Guardar el recibo de entrega (con todos los envíos pendientes) para que se pueda consultar mientras se envía
+	if err := receipts.save(pendingDeliveryReport(file, fan.addresses, fan.skipped)); err != nil {
+		fmt.Println("ERROR: Error while saving delivery receipt: " + err.Error())
+	}
+	//Esperar a que terminen todos los envíos
+	var results []deliveryResult = fan.wait()
+	var skipped int = countSkipped(results)
+	fmt.Printf("Delivered \"%v\" to %d/%d client(s) of channel %v, %d skipped by filters (transfer %v)\n", filename, countDelivered(results), len(results)-skipped, channel, skipped, file.transferID)
+	var report protocol.DeliveryReport = buildDeliveryReport(file, results)
+	if err := receipts.save(report); err != nil {
+		fmt.Println("ERROR: Error while saving delivery receipt: " + err.Error())
+	}
+	//Si el cliente lo solicitó, enviarle el reporte de entrega por la misma conexión
+	if header.Command == protocol.COMMAND_SEND_REPORTED {
+		reportBody, reportError := json.Marshal(report)
+		if reportError == nil {
+			_, reportError = connection.Write(createSimpleMessage(protocol.COMMAND_REPORT, header.Channel, reportBody))
+		}
+		if reportError != nil {
+			fmt.Println("ERROR: Error while sending delivery report to client: " + reportError.Error())
+			return 2
 		}
 	}
 	return 0
 }
 
-//Función para el envío de un archivo a un cliente suscrito
-func sendFileToClient(message []byte, fileBytes []byte, clientAddress string) {
+//Error retornado cuando el cliente rechaza el archivo (o responde algo inválido). Estos envíos no se reintentan
+type deliveryRejectedError struct {
+	reason string
+}
+
+func (e *deliveryRejectedError) Error() string {
+	return "client rejected the file (" + e.reason + ")"
+}
+
+//Error de un envío interrumpido por una causa ajena al suscriptor: la recepción del archivo falló (en modo pipeline) o
+//el servidor canceló el envío al apagarse. Estos fallos no cuentan para la salud del suscriptor
+type deliveryAbortedError struct {
+	cause error
+}
+
+func (e *deliveryAbortedError) Error() string {
+	return "delivery aborted (" + e.cause.Error() + ")"
+}
+
+func (e *deliveryAbortedError) Unwrap() error {
+	return e.cause
+}
+
+//Función que indica si un envío fallido debe reintentarse (por ejemplo si no se pudo conectar con el cliente)
+func isRetryableDelivery(err error) bool {
+	var rejected *deliveryRejectedError
+	return !errors.As(err, &rejected) && !errors.Is(err, errUnverifiableIdentity)
+}
+
+//Función que envía un archivo a un cliente suscrito y, si el envío falla por un motivo transitorio, lo agrega a la
+//cola de envíos pendientes para reintentarlo más tarde (en ese caso retorna queued = true)
+func deliverFile(file *spooledFile, clientAddress string, identity string, withDigest bool, deliveryID int64) (queued bool, err error) {
+	err = sendFileToClient(file, clientAddress, identity, withDigest, deliveryID)
+	if err != nil && isRetryableDelivery(err) {
+		queued = queueDelivery(file, clientAddress, identity, withDigest, err)
+	}
+	return queued, err
+}
+
+//Función que agrega un envío fallido a la cola de envíos pendientes. Retorna false si no se pudo encolar
+func queueDelivery(file *spooledFile, clientAddress string, identity string, withDigest bool, cause error) bool {
+	if offlineQueue == nil {
+		return false
+	}
+	return offlineQueue.enqueue(file, clientAddress, identity, withDigest, cause)
+}
+
+//Función para el envío de un archivo a un cliente suscrito (si identity no está vacío, el certificado del cliente debe
+//corresponder a esa identidad). Si withDigest es true, el mensaje termina con el digest SHA-256 del contenido
+func sendFileToClient(file *spooledFile, clientAddress string, identity string, withDigest bool, deliveryID int64) error {
 	//Conectarse con el cliente en cuestión (que en teoría debería tener un listener en la dirección recibida)
 	var connection net.Conn
 	var connectionError error
-	connection, connectionError = net.Dial("tcp", clientAddress)
-	defer connection.Close()
+	connection, connectionError = dialSubscriber(clientAddress, identity, config.DeliveryTimeout.Duration)
 	//Error check
 	if connectionError != nil {
 		fmt.Println("ERROR: Error while trying to connect to client " + clientAddress + ": " + connectionError.Error())
-		return
+		return connectionError
+	}
+	defer connection.Close()
+	//Limitar el tiempo que el envío puede pasar sin avanzar (no su duración total, que depende del tamaño del archivo)
+	if config.DeliveryTimeout.Duration > 0 {
+		connection = &idleTimeoutConn{Conn: connection, timeout: config.DeliveryTimeout.Duration}
+	}
+	//Asociar la conexión al envío registrado (para poder cancelarlo durante el apagado del servidor)
+	if !transfers.attach(deliveryID, connection) {
+		fmt.Println("ERROR: Delivery to client " + clientAddress + " was cancelled")
+		return &deliveryAbortedError{cause: errors.New("delivery cancelled")}
 	}
+	//Abrir el archivo temporal para leer su contenido
+	fileReader, openError := file.open()
+	//Error check
+	if openError != nil {
+		fmt.Println("ERROR: Error while opening spool file: " + openError.Error())
+		return openError
+	}
+	defer fileReader.Close()
 
-	//Enviar mensaje (excepto el archivo como tal, pues este se enviará iterativamente)
-	var messageError error
-	_, messageError = connection.Write(message[:10+FILENAME_MAX_LENGTH])
+	//Enviar header, canal (si es un canal con nombre) y nombre del archivo (el contenido como tal se enviará
+	//iterativamente). Si el suscriptor pidió el digest, el mensaje incluye después del contenido su digest SHA-256
+	var prefix []byte
+	var header protocol.Header = protocol.Header{Command: protocol.COMMAND_SEND, Channel: channelNumber(file.channel)}
+	if header.Channel == protocol.NAMED_CHANNEL {
+		prefix = protocol.EncodeChannelName(file.channel)
+	}
+	header.Length = int64(len(prefix)+len(file.filename)) + file.size
+	if withDigest {
+		header.Length += protocol.DIGEST_SIZE
+	}
+	var messageError error = protocol.NewEncoder(connection).EncodeHeader(header)
+	if messageError == nil {
+		_, messageError = connection.Write(append(prefix, file.filename...))
+	}
 	//Error check
 	if messageError != nil {
 		fmt.Println("ERROR: Error while sending message to client: " + messageError.Error())
-		return
+		return messageError
 	}
-	//Enviar el archivo iterativamente
-	var tempBuffer []byte = make([]byte, BUFFER_SIZE)
-	var fileReadBuffer *bytes.Buffer = bytes.NewBuffer(fileBytes)
-	var sentLength int = 0
-	for {
-		//Leer del contenido del archivo al buffer temporal
-		readBytes, readError := fileReadBuffer.Read(tempBuffer)
-		if readError != nil {
-			if readError == io.EOF {
-				fmt.Printf("File read completely (sent %d bytes)\n", sentLength)
-				break
-			}
-			fmt.Println("ERROR: Error while reading file buffer: " + readError.Error())
-			return
-		}
-		//fmt.Printf("Read %d bytes | ", readBytes)
-		//Enviar lo leído al cliente
-		sentBytes, sendError := connection.Write(tempBuffer[:readBytes])
-		if sendError != nil {
-			fmt.Println("ERROR: Error while sending file contents: " + sendError.Error())
-			return
-		}
-		//Actualizar la cantidad enviada
-		sentLength += sentBytes
-		//Comprobar que lo que se lee se esté enviando completamente
-		if readBytes != sentBytes {
-			fmt.Println("ERROR: File buffer was sent incompletely")
-			os.Exit(2)
-		}
-		//fmt.Printf("Sent %d bytes\n", sentBytes)
+	//Enviar el archivo iterativamente, leyéndolo por partes desde el disco
+	var tempBuffer []byte = make([]byte, config.BufferSize)
+	sentLength, sendError := io.CopyBuffer(connection, fileReader, tempBuffer)
+	if sendError != nil {
+		fmt.Println("ERROR: Error while sending file contents: " + sendError.Error())
+		return sendError
 	}
+	fmt.Printf("File read completely (sent %d bytes)\n", sentLength)
 	//Asegurarse de que el archivo se envió completamente
-	if sentLength != len(fileBytes) {
+	if sentLength != file.size {
 		fmt.Println("ERROR: File was sent incompletely")
-		return
+		return io.ErrShortWrite
 	}
-	//Esperar una respuesta del cliente
-	var headerBuffer []byte = make([]byte, 10)
-	var command int8
-	var contentLength int64
-	_, headerError := connection.Read(headerBuffer)
-	//Error check
-	if headerError != nil {
-		fmt.Println("ERROR: Error while receiving client's response header: " + headerError.Error())
-		return
+	//Terminar el mensaje con el digest del contenido (en modo pipeline ya se calculó, porque el contenido se termina
+	//de leer solo cuando la recepción terminó sin errores)
+	if withDigest {
+		if _, digestError := connection.Write(file.digest); digestError != nil {
+			fmt.Println("ERROR: Error while sending file digest: " + digestError.Error())
+			return digestError
+		}
 	}
-	//Parsear header
-	command = int8(headerBuffer[0])
-	contentLength = int64(binary.LittleEndian.Uint64(headerBuffer[2:]))
-	//Leer contenido del mensaje
-	var contentBuffer []byte = make([]byte, contentLength)
+	//Esperar una respuesta del cliente (se lee completa aunque llegue fragmentada)
+	var command int8
 	var content string
-	_, contentError := connection.Read(contentBuffer)
+	var responseDecoder *protocol.Decoder = protocol.NewDecoder(connection)
+	responseDecoder.MaxBodyLength = protocol.RESPONSE_MAX_LENGTH
+	response, responseError := responseDecoder.Decode()
 	//Error check
-	if contentError != nil {
-		fmt.Println("ERROR: Error while receiving client's response content: " + contentError.Error())
-		return
+	if responseError != nil {
+		fmt.Println("ERROR: Error while receiving client's response: " + responseError.Error())
+		return responseError
 	}
-	//Parsear contenido del mensaje
-	content = string(contentBuffer)
+	//Parsear la respuesta
+	command = response.Command
+	content = string(response.Body)
 	//Interpretar respuesta
 	switch command {
-	case 2:
+	case protocol.COMMAND_NOTIFY_SUCCESS:
 		fmt.Println("Sent file to client", clientAddress, "successfully")
-	case 3:
+		return nil
+	case protocol.COMMAND_NOTIFY_FAILURE:
 		fmt.Println("ERROR: Client error (" + content + ")")
+		return &deliveryRejectedError{reason: content}
 	default:
 		fmt.Println("ERROR: Invalid command received from client:", command)
+		return &deliveryRejectedError{reason: fmt.Sprintf("invalid response command %d", command)}
 	}
 }
@@ -0,0 +1,154 @@
+package main
+
+//Pruebas de los manejadores de comandos con mensajes que llegan fragmentados (un byte a la vez)
+
+import (
+	"Server/protocol"
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+//Función que prepara la configuración y el estado global que usan los manejadores, y retorna un registro de canales
+func useTestHandlers(t *testing.T, modify func(c *serverConfig)) *channelRegistry {
+	t.Helper()
+	var directory string = t.TempDir()
+	useTestConfig(t, func(c *serverConfig) {
+		c.NumberOfChannels = 2
+		c.SubscriberPolicy = SUBSCRIBER_POLICY_OPEN
+		c.SpoolDirectory = directory + "/spool"
+		c.DataDirectory = directory
+		c.BufferSize = 7
+		modify(c)
+	})
+	if err := prepareSpoolDirectory(); err != nil {
+		t.Fatal(err)
+	}
+	var registry *channelRegistry = newChannelRegistry(config.NumberOfChannels, config.MaxChannels)
+	var previousReceipts *receiptStore = receipts
+	var previousHealth *healthMonitor = subscriberHealth
+	var err error
+	if receipts, err = openReceiptStore(directory); err != nil {
+		t.Fatal(err)
+	}
+	subscriberHealth = newHealthMonitor(registry)
+	t.Cleanup(func() {
+		receipts = previousReceipts
+		subscriberHealth = previousHealth
+	})
+	return registry
+}
+
+//Función que envía mensajes al servidor un byte a la vez (a través de net.Pipe, que entrega cada escritura por
+//separado) y retorna la primera respuesta
+func exchangeOneByteAtATime(t *testing.T, registry *channelRegistry, frames ...[]byte) protocol.Frame {
+	t.Helper()
+	client, server := net.Pipe()
+	var handled chan struct{} = make(chan struct{})
+	go func() {
+		handleConnection(server, registry)
+		close(handled)
+	}()
+	go io.Copy(client, iotest.OneByteReader(bytes.NewReader(bytes.Join(frames, nil))))
+	response, err := protocol.NewDecoder(client).Decode()
+	client.Close()
+	<-handled
+	if err != nil {
+		t.Fatalf("error while reading the server's response: %v", err)
+	}
+	return response
+}
+
+//Función que retorna un mensaje dirigido a un canal con nombre (el contenido empieza con el nombre del canal)
+func namedChannelFrame(command int8, channel string, body []byte) []byte {
+	return createSimpleMessage(command, protocol.NAMED_CHANNEL, append(protocol.EncodeChannelName(channel), body...))
+}
+
+//Función que inicia un suscriptor que recibe un archivo, lo entrega por el canal retornado y responde con éxito
+func startReceivingSubscriber(t *testing.T) (string, chan protocol.Frame) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	var received chan protocol.Frame = make(chan protocol.Frame, 1)
+	go func() {
+		connection, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer connection.Close()
+		frame, err := protocol.NewDecoder(connection).Decode()
+		if err != nil {
+			return
+		}
+		connection.Write(createSimpleMessage(protocol.COMMAND_NOTIFY_SUCCESS, 0, []byte("ok")))
+		received <- frame
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestSubscribeOneByteAtATime(t *testing.T) {
+	var registry *channelRegistry = useTestHandlers(t, func(c *serverConfig) {})
+	var options string = `{"lease":"10m","filter":{"names":["*.pdf"]},"digest":true}`
+	var response protocol.Frame = exchangeOneByteAtATime(t, registry, namedChannelFrame(protocol.COMMAND_SUBSCRIBE, "builds/nightly", []byte("127.0.0.1:7201\n"+options)))
+	if response.Command != protocol.COMMAND_NOTIFY_SUCCESS || string(response.Body) != "subscribed" {
+		t.Fatalf("response = %d %q, want notify-success \"subscribed\"", response.Command, response.Body)
+	}
+	subscribers, found := registry.describeSubscribers("builds/nightly")
+	if !found || len(subscribers) != 1 {
+		t.Fatalf("subscribers = %+v (found: %v), want one subscriber", subscribers, found)
+	}
+	var subscriber protocol.SubscriberInfo = subscribers[0]
+	if subscriber.Address != "127.0.0.1:7201" || subscriber.Expires == nil || subscriber.Filter == nil || subscriber.Filter.Names[0] != "*.pdf" || !subscriber.Digest {
+		t.Fatalf("subscriber = %+v, want the address and options that were sent", subscriber)
+	}
+}
+
+func TestInvalidSubscriptionOneByteAtATime(t *testing.T) {
+	var registry *channelRegistry = useTestHandlers(t, func(c *serverConfig) {})
+	var response protocol.Frame = exchangeOneByteAtATime(t, registry, createSimpleMessage(protocol.COMMAND_SUBSCRIBE, 1, []byte("127.0.0.1:7201\n{\"unknown\":1}")))
+	if response.Command != protocol.COMMAND_NOTIFY_FAILURE {
+		t.Fatalf("response = %d %q, want notify-failure", response.Command, response.Body)
+	}
+	if subscribers, _ := registry.describeSubscribers("1"); len(subscribers) != 0 {
+		t.Fatalf("subscribers = %+v, want none", subscribers)
+	}
+}
+
+func TestCreateChannelOneByteAtATime(t *testing.T) {
+	var registry *channelRegistry = useTestHandlers(t, func(c *serverConfig) {})
+	var response protocol.Frame = exchangeOneByteAtATime(t, registry, namedChannelFrame(protocol.COMMAND_CREATE_CHANNEL, "assets/img", nil))
+	if string(response.Body) != "created" || registry.lookup("assets/img") == nil {
+		t.Fatalf("response = %d %q, want the channel to be created", response.Command, response.Body)
+	}
+}
+
+func TestSendOneByteAtATime(t *testing.T) {
+	for _, mode := range []string{FORWARD_STORE, FORWARD_PIPELINE} {
+		t.Run(mode, func(t *testing.T) {
+			var registry *channelRegistry = useTestHandlers(t, func(c *serverConfig) { c.ForwardingMode = mode })
+			address, received := startReceivingSubscriber(t)
+			if err := registry.append(address, "builds/nightly", subscription{}, 0); err != nil {
+				t.Fatal(err)
+			}
+			var filename []byte = make([]byte, config.FilenameMaxLength)
+			copy(filename, "report.txt")
+			var content []byte = []byte(strings.Repeat("file content received one byte at a time\n", 5))
+			var response protocol.Frame = exchangeOneByteAtATime(t, registry, namedChannelFrame(protocol.COMMAND_SEND, "builds/nightly", append(filename, content...)))
+			if response.Command != protocol.COMMAND_NOTIFY_SUCCESS || !strings.HasPrefix(string(response.Body), "received ") {
+				t.Fatalf("response = %d %q, want notify-success \"received <transfer-id>\"", response.Command, response.Body)
+			}
+			//El suscriptor recibe el nombre del canal, el nombre del archivo y el contenido completos
+			var delivered protocol.Frame = <-received
+			var expected []byte = append(append(protocol.EncodeChannelName("builds/nightly"), filename...), content...)
+			if delivered.Command != protocol.COMMAND_SEND || !bytes.Equal(delivered.Body, expected) {
+				t.Fatalf("delivered frame = %d %q, want send %q", delivered.Command, delivered.Body, expected)
+			}
+		})
+	}
+}
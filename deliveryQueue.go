@@ -0,0 +1,375 @@
+package main
+
+//Archivo con la cola durable de envíos pendientes. Cuando un archivo no se puede enviar a un suscriptor (por ejemplo
+//porque su listener no está disponible) se guarda una copia en el directorio de datos y se reintenta el envío con
+//backoff exponencial. Los envíos que superan la antigüedad máxima se mueven a un directorio de dead-letter para que
+//un operador los pueda revisar
+
+import (
+	"Server/protocol"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Constantes
+const QUEUE_DIRECTORY = "queue"             //Subdirectorio (del directorio de datos) con los envíos pendientes
+const DEAD_LETTER_DIRECTORY = "dead-letter" //Subdirectorio (del directorio de datos) con los envíos descartados
+const QUEUE_POLL_INTERVAL = 1 * time.Second //Cada cuánto se revisa si hay envíos pendientes que reintentar
+
+//Cola global de envíos pendientes (se inicializa en main)
+var offlineQueue *deliveryQueue
+
+//Envío pendiente. Sus metadatos se guardan en <id>.json y el contenido del archivo en <id>.data
+type queuedDelivery struct {
+	ID          string    `json:"id"`
+	TransferID  string    `json:"transfer_id"`
+	Address     string    `json:"address"`
+	Identity    string    `json:"identity,omitempty"` //Identidad que debe tener el certificado del suscriptor
+	Channel     string    `json:"channel"`
+	Name        string    `json:"name"`
+	Filename    []byte    `json:"filename"`
+	Size        int64     `json:"size"`
+	Digest      []byte    `json:"digest,omitempty"`      //Digest SHA-256 del contenido recibido
+	WithDigest  bool      `json:"with_digest,omitempty"` //Indica si el suscriptor recibe el archivo con su digest
+	Enqueued    time.Time `json:"enqueued"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error"`
+}
+
+type deliveryQueue struct {
+	mutex               sync.Mutex
+	directory           string
+	deadLetterDirectory string
+	pending             map[string][]*queuedDelivery //Envíos pendientes por suscriptor, en orden de llegada
+	busy                map[string]bool              //Suscriptores con un reintento en curso
+	registry            *channelRegistry             //Registro de canales (para no reintentar envíos a quien ya no está suscrito)
+	sequence            int64
+}
+
+//Función que abre la cola en el directorio de datos, cargando los envíos pendientes guardados. Los envíos solo se
+//reintentan mientras la dirección siga recibiendo los archivos del canal en el registro indicado
+func openDeliveryQueue(dataDirectory string, registry *channelRegistry) (*deliveryQueue, error) {
+	var q *deliveryQueue = &deliveryQueue{
+		registry:            registry,
+		directory:           filepath.Join(dataDirectory, QUEUE_DIRECTORY),
+		deadLetterDirectory: filepath.Join(dataDirectory, DEAD_LETTER_DIRECTORY),
+		pending:             make(map[string][]*queuedDelivery),
+		busy:                make(map[string]bool),
+	}
+	for _, directory := range []string{q.directory, q.deadLetterDirectory} {
+		if err := os.MkdirAll(directory, 0700); err != nil {
+			return nil, err
+		}
+	}
+	names, err := filepath.Glob(filepath.Join(q.directory, "*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range names {
+		if !strings.HasSuffix(path, ".json") {
+			//Contenidos sin metadatos (escritura interrumpida) o archivos temporales
+			if _, err := os.Stat(strings.TrimSuffix(path, ".data") + ".json"); err != nil {
+				os.Remove(path)
+			}
+			continue
+		}
+		data, err := os.ReadFile(path)
+		var delivery *queuedDelivery = new(queuedDelivery)
+		if err == nil {
+			err = json.Unmarshal(data, delivery)
+		}
+		if err == nil {
+			_, err = os.Stat(q.dataPath(delivery.ID))
+		}
+		if err != nil {
+			fmt.Println("WARNING: Discarding unreadable queued delivery " + path + ": " + err.Error())
+			os.Remove(path)
+			continue
+		}
+		q.pending[delivery.Address] = append(q.pending[delivery.Address], delivery)
+		//Los envíos guardados ocupan la cuota de su canal aunque la superen (la cuota pudo haber cambiado)
+		spoolUsage.reserve(delivery.Channel, delivery.Size, 0)
+	}
+	for _, deliveries := range q.pending {
+		sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].Enqueued.Before(deliveries[j].Enqueued) })
+	}
+	return q, nil
+}
+
+//Función que agrega a la cola un archivo que no se pudo enviar a un suscriptor. Retorna false si no se encoló
+func (q *deliveryQueue) enqueue(file *spooledFile, address string, identity string, withDigest bool, cause error) bool {
+	//En modo pipeline el archivo puede estar recibiéndose todavía: solo se encola si se recibe completo
+	if file.progress != nil {
+		if err := file.progress.result(); err != nil {
+			return false
+		}
+	}
+	//La copia en la cola ocupa la cuota del canal hasta que el envío se complete o se mueva a dead-letter
+	if !spoolUsage.reserve(file.channel, file.size, config.ChannelQuota) {
+		fmt.Printf("ERROR: Could not queue delivery of \"%v\" to %v: channel %v quota exceeded\n", file.name, address, file.channel)
+		return false
+	}
+	q.mutex.Lock()
+	q.sequence++
+	var delivery *queuedDelivery = &queuedDelivery{
+		ID:          fmt.Sprintf("%d-%d", time.Now().UnixNano(), q.sequence),
+		TransferID:  file.transferID,
+		Address:     address,
+		Identity:    identity,
+		Channel:     file.channel,
+		Name:        file.name,
+		Filename:    file.filename,
+		Size:        file.size,
+		Digest:      file.digest,
+		WithDigest:  withDigest,
+		Enqueued:    time.Now(),
+		Attempts:    1,
+		NextAttempt: time.Now().Add(retryDelay(1)),
+		LastError:   cause.Error(),
+	}
+	q.mutex.Unlock()
+	//Guardar el contenido (hard link al archivo del spool si es posible, si no una copia) y luego los metadatos
+	if err := linkOrCopy(file.path, q.dataPath(delivery.ID)); err != nil {
+		fmt.Println("ERROR: Error while queueing delivery to " + address + ": " + err.Error())
+		spoolUsage.release(file.channel, file.size)
+		return false
+	}
+	if err := q.save(delivery); err != nil {
+		fmt.Println("ERROR: Error while queueing delivery to " + address + ": " + err.Error())
+		os.Remove(q.dataPath(delivery.ID))
+		spoolUsage.release(file.channel, file.size)
+		return false
+	}
+	q.mutex.Lock()
+	q.pending[address] = append(q.pending[address], delivery)
+	q.mutex.Unlock()
+	fmt.Printf("Queued delivery of \"%v\" to %v (next attempt in %v)\n", file.name, address, retryDelay(1))
+	return true
+}
+
+//Función que revisa periódicamente los envíos pendientes e inicia los reintentos que corresponden
+func (q *deliveryQueue) run() {
+	for range time.Tick(QUEUE_POLL_INTERVAL) {
+		q.mutex.Lock()
+		for address, deliveries := range q.pending {
+			if len(deliveries) > 0 && !q.busy[address] && time.Now().After(deliveries[0].NextAttempt) {
+				q.busy[address] = true
+				go q.retry(address)
+			}
+		}
+		q.mutex.Unlock()
+	}
+}
+
+//Función que reintenta, en orden, los envíos pendientes de un suscriptor hasta que uno falle
+func (q *deliveryQueue) retry(address string) {
+	defer func() {
+		q.mutex.Lock()
+		q.busy[address] = false
+		q.mutex.Unlock()
+	}()
+	for {
+		q.mutex.Lock()
+		if len(q.pending[address]) == 0 {
+			delete(q.pending, address)
+			q.mutex.Unlock()
+			return
+		}
+		var delivery *queuedDelivery = q.pending[address][0]
+		q.mutex.Unlock()
+		if time.Now().Before(delivery.NextAttempt) {
+			return
+		}
+		//No reintentar envíos a direcciones que no cumplen la política de suscriptores (pueden haberse encolado antes
+		//de que existiera la política actual)
+		if policyError := checkSubscriberAddress(address, nil); policyError != nil {
+			q.mutex.Lock()
+			if q.isNext(address, delivery) {
+				delivery.LastError = policyError.Error()
+				q.pop(address)
+				q.moveToDeadLetter(delivery)
+			}
+			q.mutex.Unlock()
+			continue
+		}
+		//No reintentar envíos a direcciones que ya no reciben los archivos del canal (cancelaron la suscripción, esta
+		//venció o su dueño perdió el permiso de suscribirse)
+		if !q.registry.hasRecipient(delivery.Channel, address) {
+			q.mutex.Lock()
+			if q.isNext(address, delivery) {
+				delivery.LastError = "no longer subscribed to channel " + delivery.Channel
+				q.pop(address)
+				q.moveToDeadLetter(delivery)
+			}
+			q.mutex.Unlock()
+			continue
+		}
+		//Reintentar el envío a partir del contenido guardado en la cola
+		var file *spooledFile = &spooledFile{path: q.dataPath(delivery.ID), transferID: delivery.TransferID, name: delivery.Name, filename: delivery.Filename, channel: delivery.Channel, size: delivery.Size, digest: delivery.Digest}
+		fmt.Printf("Retrying delivery of \"%v\" to %v (attempt %d)...\n", delivery.Name, address, delivery.Attempts+1)
+		deliveryID, accepted := transfers.begin("queued "+file.deliveryDescription(address), nil)
+		if !accepted {
+			return
+		}
+		var err error = sendFileToClient(file, address, delivery.Identity, delivery.WithDigest, deliveryID)
+		transfers.end(deliveryID)
+		q.mutex.Lock()
+		delivery.Attempts++
+		q.mutex.Unlock()
+		subscriberHealth.recordDelivery(address, err)
+		//El envío se actualiza con el mutex bloqueado: si el suscriptor se eliminó (por ejemplo, por este fallo) sus
+		//envíos pendientes ya se movieron a dead-letter y no se deben modificar ni volver a escribir en la cola
+		q.mutex.Lock()
+		if !q.isNext(address, delivery) {
+			q.mutex.Unlock()
+			return
+		}
+		if err == nil || !isRetryableDelivery(err) {
+			//Envío completado (o rechazado por el cliente, en cuyo caso no tiene sentido reintentar)
+			q.pop(address)
+			q.discard(delivery)
+			q.mutex.Unlock()
+			if err == nil {
+				receipts.updateSubscriber(delivery.TransferID, address, protocol.DELIVERY_DELIVERED, "")
+			} else {
+				receipts.updateSubscriber(delivery.TransferID, address, protocol.DELIVERY_FAILED, rejectionReason(err))
+			}
+			continue
+		}
+		delivery.LastError = err.Error()
+		if time.Since(delivery.Enqueued) > config.QueueMaxAge.Duration {
+			//El envío superó la antigüedad máxima: se mueve al directorio de dead-letter
+			q.pop(address)
+			q.moveToDeadLetter(delivery)
+			q.mutex.Unlock()
+			continue
+		}
+		delivery.NextAttempt = time.Now().Add(retryDelay(delivery.Attempts))
+		var saveError error = q.save(delivery)
+		q.mutex.Unlock()
+		if saveError != nil {
+			fmt.Println("ERROR: Error while updating queued delivery: " + saveError.Error())
+		}
+		fmt.Printf("Delivery of \"%v\" to %v failed again (next attempt in %v)\n", delivery.Name, address, retryDelay(delivery.Attempts))
+		return
+	}
+}
+
+//Función que retira el primer envío pendiente de un suscriptor (se debe llamar con el mutex bloqueado)
+func (q *deliveryQueue) pop(address string) {
+	if len(q.pending[address]) > 0 {
+		q.pending[address] = q.pending[address][1:]
+	}
+}
+
+//Función que indica si un envío sigue siendo el primero pendiente de un suscriptor (se debe llamar con el mutex
+//bloqueado)
+func (q *deliveryQueue) isNext(address string, delivery *queuedDelivery) bool {
+	return len(q.pending[address]) > 0 && q.pending[address][0] == delivery
+}
+
+//Función que mueve a dead-letter todos los envíos pendientes de un suscriptor (por ejemplo, al eliminarlo de sus
+//canales) y retorna cuántos se movieron. Los envíos se mueven con el mutex bloqueado para que un reintento en curso
+//no los modifique ni los vuelva a guardar en la cola
+func (q *deliveryQueue) dropAddress(address string, reason string) int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	var deliveries []*queuedDelivery = q.pending[address]
+	delete(q.pending, address)
+	for _, delivery := range deliveries {
+		delivery.LastError = reason
+		q.moveToDeadLetter(delivery)
+	}
+	return len(deliveries)
+}
+
+//Función que elimina los archivos de un envío de la cola, liberando su espacio en la cuota del canal
+func (q *deliveryQueue) discard(delivery *queuedDelivery) {
+	os.Remove(q.metadataPath(delivery.ID))
+	os.Remove(q.dataPath(delivery.ID))
+	spoolUsage.release(delivery.Channel, delivery.Size)
+}
+
+//Función que mueve un envío al directorio de dead-letter (que no ocupa la cuota del canal)
+func (q *deliveryQueue) moveToDeadLetter(delivery *queuedDelivery) {
+	defer spoolUsage.release(delivery.Channel, delivery.Size)
+	if err := q.save(delivery); err != nil {
+		fmt.Println("ERROR: Error while updating queued delivery: " + err.Error())
+	}
+	var dataError error = os.Rename(q.dataPath(delivery.ID), filepath.Join(q.deadLetterDirectory, delivery.ID+".data"))
+	var metadataError error = os.Rename(q.metadataPath(delivery.ID), filepath.Join(q.deadLetterDirectory, delivery.ID+".json"))
+	if dataError != nil || metadataError != nil {
+		fmt.Printf("ERROR: Error while moving delivery %v to the dead-letter directory (%v, %v)\n", delivery.ID, dataError, metadataError)
+		return
+	}
+	fmt.Printf("Delivery of \"%v\" to %v moved to dead-letter after %d attempts (last error: %v)\n", delivery.Name, delivery.Address, delivery.Attempts, delivery.LastError)
+	receipts.updateSubscriber(delivery.TransferID, delivery.Address, protocol.DELIVERY_FAILED, "moved to dead-letter: "+delivery.LastError)
+}
+
+//Función que guarda los metadatos de un envío de manera atómica
+func (q *deliveryQueue) save(delivery *queuedDelivery) error {
+	data, err := json.MarshalIndent(delivery, "", "  ")
+	if err != nil {
+		return err
+	}
+	var temporaryPath string = q.metadataPath(delivery.ID) + ".tmp"
+	if err := os.WriteFile(temporaryPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(temporaryPath, q.metadataPath(delivery.ID))
+}
+
+func (q *deliveryQueue) metadataPath(id string) string {
+	return filepath.Join(q.directory, id+".json")
+}
+
+func (q *deliveryQueue) dataPath(id string) string {
+	return filepath.Join(q.directory, id+".data")
+}
+
+//Función que retorna la espera antes del siguiente intento, luego de la cantidad de intentos indicada
+func retryDelay(attempts int) time.Duration {
+	var delay time.Duration = config.QueueRetryDelay.Duration
+	for i := 1; i < attempts && delay < config.QueueMaxRetryDelay.Duration; i++ {
+		delay *= 2
+	}
+	if delay > config.QueueMaxRetryDelay.Duration {
+		delay = config.QueueMaxRetryDelay.Duration
+	}
+	return delay
+}
+
+//Función que crea un hard link a un archivo o, si no es posible (por ejemplo en otro sistema de archivos), una copia
+func linkOrCopy(source string, destination string) error {
+	if err := os.Link(source, destination); err == nil {
+		return nil
+	}
+	input, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+	output, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(output, input)
+	if err == nil {
+		err = output.Sync()
+	}
+	if closeError := output.Close(); err == nil {
+		err = closeError
+	}
+	if err != nil {
+		os.Remove(destination)
+	}
+	return err
+}
@@ -0,0 +1,199 @@
+package main
+
+//Archivo con el planificador del envío de un archivo a los suscriptores de un canal. Los envíos se reparten entre una
+//cantidad limitada de workers, de manera que un suscriptor lento no retrasa a todos los demás y un canal con muchos
+//suscriptores no abre una conexión por cada uno al mismo tiempo
+
+import (
+	"Server/protocol"
+	"errors"
+	"fmt"
+	"mime"
+	"path"
+	"sync"
+)
+
+//Constantes
+const DEFAULT_CONTENT_TYPE = "application/octet-stream" //Tipo de contenido de los archivos con extensión desconocida
+
+//Resultado del envío de un archivo a un suscriptor
+type deliveryResult struct {
+	address string
+	err     error  //nil si el cliente confirmó la recepción
+	queued  bool   //Indica si el envío fallido quedó en la cola de envíos pendientes
+	skipped string //Motivo por el que no se envió el archivo al suscriptor por su filtro ("" si se envió)
+}
+
+//Envío de un archivo a una lista de suscriptores
+type fanout struct {
+	file       *spooledFile
+	addresses  []string
+	identities []string //Identidad que debe tener el certificado de cada suscriptor ("" si no se verifica)
+	digests    []bool   //Indica si cada suscriptor recibe el archivo con su digest
+	skipped    []string //Motivo por el que se omite a cada suscriptor ("" si se le envía el archivo)
+	results    []deliveryResult
+	done       sync.WaitGroup
+}
+
+//Función que inicia el envío de un archivo a una lista de clientes usando como máximo config.FanoutWorkers envíos
+//simultáneos. Los clientes cuyos filtros no acepta el archivo se omiten
+func startFanout(file *spooledFile, recipients []recipient) *fanout {
+	var f *fanout = &fanout{file: file, addresses: make([]string, len(recipients)), identities: make([]string, len(recipients)), digests: make([]bool, len(recipients)), skipped: make([]string, len(recipients)), results: make([]deliveryResult, len(recipients))}
+	var clientList []string = f.addresses
+	var contentType string = contentTypeOf(file.name)
+	//Cola de trabajos: índices de la lista de clientes
+	var jobs chan int = make(chan int, len(recipients))
+	for i, target := range recipients {
+		clientList[i] = target.address
+		f.identities[i] = target.certificate
+		f.digests[i] = target.digest
+		if reason := filterReason(target.filters, file, contentType); reason != "" {
+			fmt.Printf("(%d/%d) Skipping client %v: %v\n", i+1, len(clientList), target.address, reason)
+			f.skipped[i] = reason
+			f.results[i] = deliveryResult{address: target.address, skipped: reason}
+			continue
+		}
+		jobs <- i
+	}
+	close(jobs)
+	var workers int = config.FanoutWorkers
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+	f.done.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer f.done.Done()
+			for i := range jobs {
+				fmt.Printf("(%d/%d) Sending file to client %v...\n", i+1, len(clientList), clientList[i])
+				f.results[i] = f.deliver(clientList[i], f.identities[i], f.digests[i])
+			}
+		}()
+	}
+	return f
+}
+
+//Función que retorna el motivo por el que un archivo no se envía a un suscriptor ("" si alguno de los filtros de sus
+//suscripciones acepta el archivo)
+func filterReason(filters []*protocol.SubscriptionFilter, file *spooledFile, contentType string) string {
+	var reason string
+	for _, filter := range filters {
+		matched, criterion := filter.Match(file.name, file.size, contentType)
+		if matched {
+			return ""
+		}
+		if reason == "" {
+			reason = "filtered out by subscription (" + criterion + ")"
+		}
+	}
+	return reason
+}
+
+//Función que retorna el tipo de contenido de un archivo según la extensión de su nombre
+func contentTypeOf(filename string) string {
+	mediaType, _, err := mime.ParseMediaType(mime.TypeByExtension(path.Ext(filename)))
+	if err != nil {
+		return DEFAULT_CONTENT_TYPE
+	}
+	return mediaType
+}
+
+//Función que realiza un envío, registrándolo como transferencia en curso (identity: identidad que debe tener el
+//certificado del suscriptor, "" si no se verifica; withDigest: si el mensaje incluye el digest del archivo)
+func (f *fanout) deliver(clientAddress string, identity string, withDigest bool) deliveryResult {
+	deliveryID, accepted := transfers.begin(f.file.deliveryDescription(clientAddress), nil)
+	if !accepted {
+		//El servidor se está apagando: el envío se deja en la cola para hacerlo al reiniciar
+		var err error = &deliveryAbortedError{cause: errors.New("server shutting down")}
+		return deliveryResult{address: clientAddress, err: err, queued: queueDelivery(f.file, clientAddress, identity, withDigest, err)}
+	}
+	defer transfers.end(deliveryID)
+	queued, err := deliverFile(f.file, clientAddress, identity, withDigest, deliveryID)
+	subscriberHealth.recordDelivery(clientAddress, err)
+	return deliveryResult{address: clientAddress, err: err, queued: queued}
+}
+
+//Función que espera a que terminen todos los envíos y retorna sus resultados
+func (f *fanout) wait() []deliveryResult {
+	f.done.Wait()
+	return f.results
+}
+
+//Función que retorna cuántos envíos se completaron con éxito
+func countDelivered(results []deliveryResult) int {
+	var delivered int = 0
+	for _, result := range results {
+		if result.err == nil && result.skipped == "" {
+			delivered++
+		}
+	}
+	return delivered
+}
+
+//Función que retorna a cuántos suscriptores se omitió por su filtro
+func countSkipped(results []deliveryResult) int {
+	var skipped int = 0
+	for _, result := range results {
+		if result.skipped != "" {
+			skipped++
+		}
+	}
+	return skipped
+}
+
+//Función que retorna el motivo de un envío fallido. Si el cliente rechazó el archivo se retorna el motivo que envió
+//en su notify-failure
+func rejectionReason(err error) string {
+	var rejected *deliveryRejectedError
+	if errors.As(err, &rejected) {
+		return rejected.reason
+	}
+	return err.Error()
+}
+
+//Función que arma el reporte de entrega a partir de los resultados de los envíos
+func buildDeliveryReport(file *spooledFile, results []deliveryResult) protocol.DeliveryReport {
+	var report protocol.DeliveryReport = protocol.DeliveryReport{
+		TransferID:  file.transferID,
+		Filename:    file.name,
+		Channel:     file.channel,
+		Delivered:   countDelivered(results),
+		Total:       len(results),
+		Skipped:     countSkipped(results),
+		Subscribers: make([]protocol.SubscriberStatus, len(results)),
+	}
+	for i, result := range results {
+		var status protocol.SubscriberStatus = protocol.SubscriberStatus{Address: result.address, Status: protocol.DELIVERY_DELIVERED}
+		if result.skipped != "" {
+			status.Status = protocol.DELIVERY_SKIPPED
+			status.Reason = result.skipped
+		} else if result.err != nil {
+			status.Status = protocol.DELIVERY_FAILED
+			if result.queued {
+				status.Status = protocol.DELIVERY_QUEUED
+			}
+			status.Reason = rejectionReason(result.err)
+		}
+		report.Subscribers[i] = status
+	}
+	return report
+}
+
+//Función que arma el reporte de entrega inicial de un envío (con todos los suscriptores pendientes, excepto los omitidos)
+func pendingDeliveryReport(file *spooledFile, addresses []string, skipped []string) protocol.DeliveryReport {
+	var report protocol.DeliveryReport = protocol.DeliveryReport{
+		TransferID:  file.transferID,
+		Filename:    file.name,
+		Channel:     file.channel,
+		Total:       len(addresses),
+		Subscribers: make([]protocol.SubscriberStatus, len(addresses)),
+	}
+	for i, address := range addresses {
+		report.Subscribers[i] = protocol.SubscriberStatus{Address: address, Status: protocol.DELIVERY_PENDING}
+		if skipped[i] != "" {
+			report.Subscribers[i] = protocol.SubscriberStatus{Address: address, Status: protocol.DELIVERY_SKIPPED, Reason: skipped[i]}
+			report.Skipped++
+		}
+	}
+	return report
+}
@@ -0,0 +1,108 @@
+package main
+
+//Archivo con el monitoreo de salud de los suscriptores. Se cuentan los fallos consecutivos de cada dirección suscrita,
+//tanto de los envíos como de un sondeo periódico (conexión TCP a su listener), y las direcciones que alcanzan el
+//umbral configurado se eliminan de todos sus canales
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+//Monitor global de salud de los suscriptores (se inicializa en main)
+var subscriberHealth *healthMonitor
+
+type healthMonitor struct {
+	mutex    sync.Mutex
+	registry *channelRegistry
+	failures map[string]int //Fallos consecutivos por dirección
+}
+
+//Función que retorna un nuevo monitor sobre el registro de canales
+func newHealthMonitor(registry *channelRegistry) *healthMonitor {
+	return &healthMonitor{registry: registry, failures: make(map[string]int)}
+}
+
+//Función que registra el resultado de un envío a un suscriptor. Un rechazo del cliente cuenta como éxito, pues
+//demuestra que su listener está disponible. Los envíos interrumpidos por una causa ajena al suscriptor (recepción
+//fallida del archivo o apagado del servidor, que cierra las conexiones de los envíos) no se registran
+func (h *healthMonitor) recordDelivery(address string, err error) {
+	var aborted *deliveryAbortedError
+	if errors.As(err, &aborted) || (err != nil && transfers.isCancelled()) {
+		return
+	}
+	if err == nil || !isRetryableDelivery(err) {
+		h.recordSuccess(address)
+	} else {
+		h.recordFailure(address, err)
+	}
+}
+
+//Función que reinicia el contador de fallos de una dirección
+func (h *healthMonitor) recordSuccess(address string) {
+	h.mutex.Lock()
+	delete(h.failures, address)
+	h.mutex.Unlock()
+}
+
+//Función que registra un fallo de una dirección y la elimina de sus canales si alcanza el umbral
+func (h *healthMonitor) recordFailure(address string, cause error) {
+	if config.EvictionThreshold == 0 {
+		return
+	}
+	h.mutex.Lock()
+	h.failures[address]++
+	var failures int = h.failures[address]
+	if failures >= config.EvictionThreshold {
+		delete(h.failures, address)
+	}
+	h.mutex.Unlock()
+	if failures < config.EvictionThreshold {
+		return
+	}
+	var channels []string = h.registry.channelsOf(address)
+	for _, channel := range channels {
+		h.registry.removeSubscriptor(address, channel)
+	}
+	if len(channels) > 0 {
+		fmt.Printf("Evicted subscriber %v from channel(s) %v after %d consecutive failures (last: %v)\n", address, channels, failures, cause)
+	}
+	//Dejar de reintentar los envíos pendientes al suscriptor eliminado
+	if offlineQueue != nil {
+		if dropped := offlineQueue.dropAddress(address, fmt.Sprintf("subscriber evicted after %d consecutive failures", failures)); dropped > 0 {
+			fmt.Printf("Moved %d pending delivery(ies) to evicted subscriber %v to dead-letter\n", dropped, address)
+		}
+	}
+}
+
+//Función que sondea periódicamente a todos los suscriptores
+func (h *healthMonitor) run() {
+	for range time.Tick(config.HealthCheckInterval.Duration) {
+		h.probeAll()
+	}
+}
+
+//Función que sondea a todos los suscriptores (como máximo config.FanoutWorkers a la vez)
+func (h *healthMonitor) probeAll() {
+	var slots chan struct{} = make(chan struct{}, config.FanoutWorkers)
+	var probes sync.WaitGroup
+	for _, address := range h.registry.addresses() {
+		slots <- struct{}{}
+		probes.Add(1)
+		go func(address string) {
+			defer probes.Done()
+			defer func() { <-slots }()
+			connection, err := net.DialTimeout("tcp", address, config.HealthCheckTimeout.Duration)
+			if err != nil {
+				h.recordFailure(address, err)
+				return
+			}
+			connection.Close()
+			h.recordSuccess(address)
+		}(address)
+	}
+	probes.Wait()
+}
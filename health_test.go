@@ -0,0 +1,99 @@
+package main
+
+//Pruebas del monitoreo de salud de los suscriptores
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//Función que inicia un suscriptor que lee todo lo que recibe sin responder y retorna su dirección
+func startReadingSubscriber(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			connection, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(io.Discard, connection)
+				connection.Close()
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+//Función que retorna un registro con una dirección suscrita al canal indicado y un monitor de salud sobre él
+func newTestHealthMonitor(t *testing.T, address string, channel string) (*channelRegistry, *healthMonitor) {
+	t.Helper()
+	var registry *channelRegistry = newChannelRegistry(0, 0)
+	if err := registry.append(address, channel, subscription{}, 0); err != nil {
+		t.Fatal(err)
+	}
+	return registry, newHealthMonitor(registry)
+}
+
+func TestTruncatedPipelineUploadDoesNotEvictSubscriber(t *testing.T) {
+	useTestConfig(t, func(c *serverConfig) {
+		c.NumberOfChannels = 0
+		c.EvictionThreshold = 1
+	})
+	var address string = startReadingSubscriber(t)
+	registry, health := newTestHealthMonitor(t, address, "builds")
+
+	//Archivo que se está recibiendo en modo pipeline: llegó la mitad y la recepción termina con error
+	var path string = filepath.Join(t.TempDir(), "upload.spool")
+	if err := os.WriteFile(path, make([]byte, 512), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var file *spooledFile = &spooledFile{path: path, name: "a.bin", filename: make([]byte, config.FilenameMaxLength), channel: "builds", size: 1024, progress: newSpoolProgress(-1)}
+	file.progress.advance(512)
+	file.progress.finish(io.ErrUnexpectedEOF)
+
+	deliveryID, _ := transfers.begin(file.deliveryDescription(address), nil)
+	var err error = sendFileToClient(file, address, "", false, deliveryID)
+	transfers.end(deliveryID)
+	var aborted *deliveryAbortedError
+	if !errors.As(err, &aborted) || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("sendFileToClient() error = %v, want a deliveryAbortedError wrapping io.ErrUnexpectedEOF", err)
+	}
+	health.recordDelivery(address, err)
+	if channels := registry.channelsOf(address); len(channels) != 1 {
+		t.Fatalf("subscriber was evicted by a failed upload (channels: %v)", channels)
+	}
+}
+
+func TestCancelledDeliveryDoesNotEvictSubscriber(t *testing.T) {
+	useTestConfig(t, func(c *serverConfig) {
+		c.NumberOfChannels = 0
+		c.EvictionThreshold = 1
+	})
+	registry, health := newTestHealthMonitor(t, "127.0.0.1:1", "builds")
+	health.recordDelivery("127.0.0.1:1", &deliveryAbortedError{cause: errors.New("delivery cancelled")})
+	if channels := registry.channelsOf("127.0.0.1:1"); len(channels) != 1 {
+		t.Fatalf("subscriber was evicted by a cancelled delivery (channels: %v)", channels)
+	}
+}
+
+func TestFailedDeliveryEvictsSubscriber(t *testing.T) {
+	useTestConfig(t, func(c *serverConfig) {
+		c.NumberOfChannels = 0
+		c.EvictionThreshold = 1
+	})
+	registry, health := newTestHealthMonitor(t, "127.0.0.1:1", "builds")
+	health.recordDelivery("127.0.0.1:1", errors.New("connection refused"))
+	if channels := registry.channelsOf("127.0.0.1:1"); len(channels) != 0 {
+		t.Fatalf("subscriber wasn't evicted after reaching the threshold (channels: %v)", channels)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+//Archivo con funciones de apoyo para el manejo de errores del listener del servidor
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"time"
+)
+
+//Constantes
+const ACCEPT_RETRY_MIN_DELAY = 5 * time.Millisecond //Espera inicial antes de reintentar un Accept que falló temporalmente
+const ACCEPT_RETRY_MAX_DELAY = 1 * time.Second      //Espera máxima entre reintentos
+
+//Función que indica si un error retornado por listener.Accept es temporal (el listener sigue siendo utilizable y se
+//puede reintentar), como quedarse sin descriptores de archivo o una conexión abortada antes de ser aceptada
+func isTemporaryAcceptError(err error) bool {
+	if errors.Is(err, net.ErrClosed) {
+		return false
+	}
+	var temporaryErrors []error = []error{
+		syscall.EMFILE,       //too many open files (proceso)
+		syscall.ENFILE,       //too many open files (sistema)
+		syscall.ENOBUFS,      //no buffer space available
+		syscall.ENOMEM,       //cannot allocate memory
+		syscall.ECONNABORTED, //la conexión fue abortada antes de aceptarla
+		syscall.ECONNRESET,   //la conexión fue reiniciada antes de aceptarla
+		syscall.EINTR,        //llamada interrumpida
+	}
+	for _, temporaryError := range temporaryErrors {
+		if errors.Is(err, temporaryError) {
+			return true
+		}
+	}
+	//Otros errores que el paquete net marca como temporales (mismo criterio que net/http)
+	var netError net.Error
+	if errors.As(err, &netError) && (netError.Timeout() || netError.Temporary()) {
+		return true
+	}
+	return false
+}
+
+//Función que retorna la siguiente espera del backoff exponencial para reintentar un Accept
+func nextAcceptRetryDelay(previous time.Duration) time.Duration {
+	if previous == 0 {
+		return ACCEPT_RETRY_MIN_DELAY
+	}
+	var next time.Duration = previous * 2
+	if next > ACCEPT_RETRY_MAX_DELAY {
+		next = ACCEPT_RETRY_MAX_DELAY
+	}
+	return next
+}
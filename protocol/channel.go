@@ -0,0 +1,119 @@
+package protocol
+
+//Archivo con la extensión del protocolo para canales con nombre (ej. "builds/nightly") y patrones de canales para las
+//suscripciones (ej. "builds/*"). Los canales numerados se identifican directamente con el byte de canal del header;
+//para un canal con nombre (o un patrón) el byte de canal es NAMED_CHANNEL y el contenido del mensaje empieza con la
+//longitud del nombre (1 byte) seguida del nombre
+
+import (
+	"errors"
+	"strings"
+)
+
+//Constantes de los canales con nombre
+const NAMED_CHANNEL int8 = 0        //Valor del byte de canal que indica que el contenido empieza con el nombre del canal
+const CHANNEL_NAME_MAX_LENGTH = 128 //Longitud máxima del nombre de un canal
+const CHANNEL_NAME_SEPARATOR = "/"  //Separador de los segmentos del nombre de un canal
+const CHANNEL_NAME_SYMBOLS = "-_."  //Símbolos permitidos en un segmento (además de letras y dígitos)
+const CHANNEL_WILDCARD_ONE = "*"    //Comodín que coincide con exactamente un segmento
+const CHANNEL_WILDCARD_TAIL = "#"   //Comodín (solo como último segmento) que coincide con cero o más segmentos
+
+//Errores relacionados con el nombre de un canal
+var (
+	ErrInvalidChannelName = errors.New("invalid channel name")
+	ErrUnexpectedWildcard = errors.New("channel patterns are only allowed in subscriptions")
+)
+
+//Función que indica si un nombre de canal es válido: uno o más segmentos no vacíos separados por "/", formados por
+//letras, dígitos y los símbolos "-", "_" y "."
+func IsValidChannelName(name string) bool {
+	if len(name) == 0 || len(name) > CHANNEL_NAME_MAX_LENGTH {
+		return false
+	}
+	for _, segment := range strings.Split(name, CHANNEL_NAME_SEPARATOR) {
+		if !isValidSegment(segment) {
+			return false
+		}
+	}
+	return true
+}
+
+//Función que indica si un patrón de canales es válido: un nombre de canal en el que cualquier segmento puede ser el
+//comodín "*" (coincide con exactamente un segmento) y el último segmento puede ser "#" (coincide con cero o más
+//segmentos). Un nombre de canal sin comodines también es un patrón válido
+func IsValidChannelPattern(pattern string) bool {
+	if len(pattern) == 0 || len(pattern) > CHANNEL_NAME_MAX_LENGTH {
+		return false
+	}
+	var segments []string = strings.Split(pattern, CHANNEL_NAME_SEPARATOR)
+	for i, segment := range segments {
+		if segment == CHANNEL_WILDCARD_ONE || (segment == CHANNEL_WILDCARD_TAIL && i == len(segments)-1) {
+			continue
+		}
+		if !isValidSegment(segment) {
+			return false
+		}
+	}
+	return true
+}
+
+//Función que indica si un patrón de canales contiene comodines (es decir, si no es el nombre de un solo canal)
+func IsChannelPattern(pattern string) bool {
+	for _, segment := range strings.Split(pattern, CHANNEL_NAME_SEPARATOR) {
+		if segment == CHANNEL_WILDCARD_ONE || segment == CHANNEL_WILDCARD_TAIL {
+			return true
+		}
+	}
+	return false
+}
+
+//Función que indica si un segmento del nombre de un canal es válido
+func isValidSegment(segment string) bool {
+	if len(segment) == 0 {
+		return false
+	}
+	for _, character := range segment {
+		var isLetter bool = (character >= 'a' && character <= 'z') || (character >= 'A' && character <= 'Z')
+		var isDigit bool = character >= '0' && character <= '9'
+		if !isLetter && !isDigit && !strings.ContainsRune(CHANNEL_NAME_SYMBOLS, character) {
+			return false
+		}
+	}
+	return true
+}
+
+//Función que retorna el nombre de un canal codificado para el inicio del contenido (longitud + nombre)
+func EncodeChannelName(name string) []byte {
+	return append([]byte{byte(len(name))}, name...)
+}
+
+//Función que retorna un mensaje dirigido a un canal con nombre
+func NamedFrame(command int8, channelName string, body []byte) Frame {
+	return Frame{Command: command, Channel: NAMED_CHANNEL, Body: append(EncodeChannelName(channelName), body...)}
+}
+
+//Función que lee el nombre del canal (o el patrón de canales, ver IsValidChannelPattern) al inicio del contenido de un
+//mensaje con NAMED_CHANNEL, descontándolo de la longitud del header (de manera que el header quede describiendo el
+//resto del contenido)
+func (d *Decoder) DecodeChannelName(header *Header) (string, error) {
+	if header.Length < 1 {
+		return "", ErrInvalidChannelName
+	}
+	var lengthBuffer []byte = make([]byte, 1)
+	if err := d.ReadField("channel name length", lengthBuffer); err != nil {
+		return "", err
+	}
+	var nameLength int64 = int64(lengthBuffer[0])
+	if nameLength == 0 || 1+nameLength > header.Length {
+		return "", ErrInvalidChannelName
+	}
+	var nameBuffer []byte = make([]byte, nameLength)
+	if err := d.ReadField("channel name", nameBuffer); err != nil {
+		return "", err
+	}
+	if !IsValidChannelPattern(string(nameBuffer)) {
+		return "", ErrInvalidChannelName
+	}
+	header.Length -= 1 + nameLength
+	return string(nameBuffer), nil
+}
@@ -0,0 +1,74 @@
+package protocol
+
+//Archivo con el decodificador de mensajes del protocolo
+
+import (
+	"io"
+)
+
+//Decodificador que lee mensajes del protocolo desde un io.Reader
+type Decoder struct {
+	reader        io.Reader
+	MaxBodyLength int64 //Longitud máxima permitida para el contenido de un mensaje (0: sin límite)
+}
+
+//Función que retorna un nuevo decodificador sobre el reader recibido
+func NewDecoder(reader io.Reader) *Decoder {
+	return &Decoder{reader: reader}
+}
+
+//Función que lee y valida el header de un mensaje
+func (d *Decoder) DecodeHeader() (Header, error) {
+	var headerBuffer []byte = make([]byte, HEADER_SIZE)
+	//Leer el comando
+	if _, err := io.ReadFull(d.reader, headerBuffer[:1]); err != nil {
+		return Header{}, &ReadError{Field: "command", Err: err}
+	}
+	//Leer el canal
+	if _, err := io.ReadFull(d.reader, headerBuffer[1:2]); err != nil {
+		return Header{}, &ReadError{Field: "channel", Err: err}
+	}
+	//Leer la longitud del contenido
+	if _, err := io.ReadFull(d.reader, headerBuffer[2:]); err != nil {
+		return Header{}, &ReadError{Field: "length", Err: err}
+	}
+	var header Header = parseHeader(headerBuffer)
+	//Validar el header
+	if !IsValidCommand(header.Command) {
+		return header, &HeaderError{Header: header, Err: ErrInvalidCommand}
+	}
+	if header.Length < 0 {
+		return header, &HeaderError{Header: header, Err: ErrInvalidLength}
+	}
+	if d.MaxBodyLength > 0 && header.Length > d.MaxBodyLength {
+		return header, &HeaderError{Header: header, Err: ErrBodyTooLarge}
+	}
+	return header, nil
+}
+
+//Función que lee un mensaje completo (header + contenido)
+func (d *Decoder) Decode() (Frame, error) {
+	header, err := d.DecodeHeader()
+	if err != nil {
+		return Frame{}, err
+	}
+	var body []byte = make([]byte, header.Length)
+	if _, err := io.ReadFull(d.reader, body); err != nil {
+		return Frame{}, &ReadError{Field: "content", Err: err}
+	}
+	return Frame{Command: header.Command, Channel: header.Channel, Body: body}, nil
+}
+
+//Función que lee un campo de tamaño fijo del contenido, esperando hasta que llegue completo aunque TCP
+//lo entregue fragmentado
+func (d *Decoder) ReadField(field string, buffer []byte) error {
+	if _, err := io.ReadFull(d.reader, buffer); err != nil {
+		return &ReadError{Field: field, Err: err}
+	}
+	return nil
+}
+
+//Función que retorna un reader limitado a los siguientes length bytes del contenido del mensaje
+func (d *Decoder) Body(length int64) io.Reader {
+	return io.LimitReader(d.reader, length)
+}
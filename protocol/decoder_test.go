@@ -0,0 +1,113 @@
+package protocol
+
+//Pruebas del decodificador: los mensajes deben reconstruirse completos aunque el reader entregue un byte a la vez
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+//Función que retorna un decodificador que lee los bytes indicados de a uno
+func oneByteDecoder(data []byte) *Decoder {
+	return NewDecoder(iotest.OneByteReader(bytes.NewReader(data)))
+}
+
+func TestDecodeHeaderOneByte(t *testing.T) {
+	var frame Frame = Frame{Command: COMMAND_SEND, Channel: 3, Body: []byte("content")}
+	header, err := oneByteDecoder(frame.Bytes()).DecodeHeader()
+	if err != nil {
+		t.Fatalf("DecodeHeader: %v", err)
+	}
+	if header != frame.Header() {
+		t.Fatalf("header = %+v, want %+v", header, frame.Header())
+	}
+}
+
+func TestReadFieldOneByte(t *testing.T) {
+	var filename []byte = make([]byte, 40)
+	copy(filename, "file.txt")
+	var frame Frame = Frame{Command: COMMAND_SEND, Channel: 1, Body: append(append([]byte{}, filename...), "hello"...)}
+	var decoder *Decoder = oneByteDecoder(frame.Bytes())
+	if _, err := decoder.DecodeHeader(); err != nil {
+		t.Fatalf("DecodeHeader: %v", err)
+	}
+	var field []byte = make([]byte, len(filename))
+	if err := decoder.ReadField("filename", field); err != nil {
+		t.Fatalf("ReadField: %v", err)
+	}
+	if !bytes.Equal(field, filename) {
+		t.Fatalf("filename = %q, want %q", field, filename)
+	}
+	content, err := io.ReadAll(decoder.Body(5))
+	if err != nil || string(content) != "hello" {
+		t.Fatalf("body = %q (%v), want %q", content, err, "hello")
+	}
+}
+
+func TestReadFieldIncomplete(t *testing.T) {
+	var decoder *Decoder = oneByteDecoder([]byte("abc"))
+	var readError *ReadError
+	if err := decoder.ReadField("token", make([]byte, 5)); !errors.As(err, &readError) || readError.Field != "token" {
+		t.Fatalf("ReadField error = %v, want a ReadError for token", err)
+	}
+}
+
+func TestDecodeChannelNameOneByte(t *testing.T) {
+	var frame Frame = NamedFrame(COMMAND_SUBSCRIBE, "builds/linux", []byte("127.0.0.1:9000"))
+	var decoder *Decoder = oneByteDecoder(frame.Bytes())
+	header, err := decoder.DecodeHeader()
+	if err != nil {
+		t.Fatalf("DecodeHeader: %v", err)
+	}
+	name, err := decoder.DecodeChannelName(&header)
+	if err != nil {
+		t.Fatalf("DecodeChannelName: %v", err)
+	}
+	if name != "builds/linux" {
+		t.Fatalf("name = %q, want %q", name, "builds/linux")
+	}
+	if header.Length != int64(len("127.0.0.1:9000")) {
+		t.Fatalf("remaining length = %d, want %d", header.Length, len("127.0.0.1:9000"))
+	}
+	var address []byte = make([]byte, header.Length)
+	if err := decoder.ReadField("content", address); err != nil || string(address) != "127.0.0.1:9000" {
+		t.Fatalf("content = %q (%v)", address, err)
+	}
+}
+
+func TestDecodeOneByte(t *testing.T) {
+	var frames []Frame = []Frame{
+		{Command: COMMAND_NOTIFY_SUCCESS, Channel: 2, Body: []byte("subscribed")},
+		{Command: COMMAND_NOTIFY_FAILURE, Channel: 0, Body: []byte{}},
+		{Command: COMMAND_REPORT, Channel: 7, Body: bytes.Repeat([]byte("x"), 1000)},
+	}
+	var stream []byte
+	for _, frame := range frames {
+		stream = append(stream, frame.Bytes()...)
+	}
+	var decoder *Decoder = oneByteDecoder(stream)
+	for i, want := range frames {
+		got, err := decoder.Decode()
+		if err != nil {
+			t.Fatalf("Decode frame %d: %v", i, err)
+		}
+		if got.Command != want.Command || got.Channel != want.Channel || !bytes.Equal(got.Body, want.Body) {
+			t.Fatalf("frame %d = %+v, want %+v", i, got, want)
+		}
+	}
+	if _, err := decoder.Decode(); !errors.Is(err, io.EOF) {
+		t.Fatalf("Decode after the last frame = %v, want EOF", err)
+	}
+}
+
+func TestDecodeBodyTooLarge(t *testing.T) {
+	var header Header = Header{Command: COMMAND_NOTIFY_SUCCESS, Channel: 1, Length: 1 << 60}
+	var decoder *Decoder = oneByteDecoder(header.Bytes())
+	decoder.MaxBodyLength = RESPONSE_MAX_LENGTH
+	if _, err := decoder.Decode(); !errors.Is(err, ErrBodyTooLarge) {
+		t.Fatalf("Decode = %v, want %v", err, ErrBodyTooLarge)
+	}
+}
@@ -0,0 +1,33 @@
+package protocol
+
+//Archivo con el codificador de mensajes del protocolo
+
+import (
+	"io"
+)
+
+//Codificador que escribe mensajes del protocolo sobre un io.Writer
+type Encoder struct {
+	writer io.Writer
+}
+
+//Función que retorna un nuevo codificador sobre el writer recibido
+func NewEncoder(writer io.Writer) *Encoder {
+	return &Encoder{writer: writer}
+}
+
+//Función que escribe un mensaje completo
+func (e *Encoder) Encode(frame Frame) error {
+	_, err := e.writer.Write(frame.Bytes())
+	return err
+}
+
+//Función que escribe únicamente un header. El contenido (header.Length bytes) debe escribirse después
+//directamente sobre el writer, lo que permite enviar contenidos largos por partes
+func (e *Encoder) EncodeHeader(header Header) error {
+	if header.Length < 0 {
+		return &HeaderError{Header: header, Err: ErrInvalidLength}
+	}
+	_, err := e.writer.Write(header.Bytes())
+	return err
+}
@@ -0,0 +1,121 @@
+package protocol
+
+//Paquete que contiene la definición del protocolo usado entre el servidor y sus clientes. Cada mensaje (frame)
+//tiene la estructura: comando (1 byte) + canal (1 byte) + longitud del contenido (8 bytes, little-endian) + contenido
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+//Constantes del protocolo
+const HEADER_SIZE = 10                //Tamaño del header de un mensaje (comando + canal + longitud)
+const DIGEST_SIZE = 32                //Tamaño del digest SHA-256 de un archivo (contenido de un mensaje digest)
+const RESPONSE_MAX_LENGTH = 64 * 1024 //Longitud máxima del contenido de una respuesta (notify-success/notify-failure)
+
+//Comandos existentes en el protocolo
+const (
+	COMMAND_SUBSCRIBE        int8 = 0  //Solicitud de suscripción
+	COMMAND_SEND             int8 = 1  //Solicitud de envío de archivo
+	COMMAND_NOTIFY_SUCCESS   int8 = 2  //Notificar recepción/procesamiento exitoso de mensaje
+	COMMAND_NOTIFY_FAILURE   int8 = 3  //Notificar error durante recepción/procesamiento de mensaje
+	COMMAND_UNSUBSCRIBE      int8 = 4  //Solicitud para cancelar suscripción
+	COMMAND_SEND_REPORTED    int8 = 5  //Solicitud de envío de archivo, esperando el reporte de entrega a los suscriptores
+	COMMAND_REPORT           int8 = 6  //Reporte de entrega de un archivo (contenido JSON, ver DeliveryReport)
+	COMMAND_RECEIPT          int8 = 7  //Consulta del reporte de entrega de una transferencia (contenido: ID de transferencia)
+	COMMAND_CREATE_CHANNEL   int8 = 8  //Creación explícita de un canal con nombre
+	COMMAND_LIST_CHANNELS    int8 = 9  //Consulta de los canales y su cantidad de suscriptores (respuesta JSON, ver ChannelList)
+	COMMAND_LIST_SUBSCRIBERS int8 = 10 //Consulta de los suscriptores de un canal (contenido: token de administración; respuesta JSON, ver SubscriberList)
+	COMMAND_AUTHENTICATE     int8 = 11 //Autenticación del cliente (contenido: token), seguida del comando a ejecutar
+	COMMAND_DIGEST           int8 = 12 //Digest SHA-256 del contenido del archivo del mensaje send que le sigue (DIGEST_SIZE bytes)
+	COMMAND_DELETE_CHANNEL   int8 = 13 //Eliminación de un canal con nombre sin suscriptores
+)
+
+//Errores de validación que puede retornar el decodificador
+var (
+	ErrInvalidCommand = errors.New("invalid command")
+	ErrInvalidLength  = errors.New("invalid content length")
+	ErrBodyTooLarge   = errors.New("content length exceeds maximum allowed")
+)
+
+//Header de un mensaje
+type Header struct {
+	Command int8
+	Channel int8
+	Length  int64
+}
+
+//Mensaje completo (header + contenido)
+type Frame struct {
+	Command int8
+	Channel int8
+	Body    []byte
+}
+
+//Error producido al leer un campo de un mensaje desde la conexión
+type ReadError struct {
+	Field string //Campo que se intentaba leer (command, channel, length, content, ...)
+	Err   error
+}
+
+func (e *ReadError) Error() string {
+	return "error while reading " + e.Field + ": " + e.Err.Error()
+}
+
+func (e *ReadError) Unwrap() error {
+	return e.Err
+}
+
+//Error producido cuando un header recibido no es válido
+type HeaderError struct {
+	Header Header
+	Err    error
+}
+
+func (e *HeaderError) Error() string {
+	return fmt.Sprintf("invalid header (command: %d, channel: %d, length: %d): %v", e.Header.Command, e.Header.Channel, e.Header.Length, e.Err)
+}
+
+func (e *HeaderError) Unwrap() error {
+	return e.Err
+}
+
+//Función que indica si un comando pertenece al protocolo
+func IsValidCommand(command int8) bool {
+	switch command {
+	case COMMAND_SUBSCRIBE, COMMAND_SEND, COMMAND_NOTIFY_SUCCESS, COMMAND_NOTIFY_FAILURE, COMMAND_UNSUBSCRIBE,
+		COMMAND_SEND_REPORTED, COMMAND_REPORT, COMMAND_RECEIPT, COMMAND_CREATE_CHANNEL,
+		COMMAND_LIST_CHANNELS, COMMAND_LIST_SUBSCRIBERS, COMMAND_AUTHENTICATE, COMMAND_DIGEST, COMMAND_DELETE_CHANNEL:
+		return true
+	}
+	return false
+}
+
+//Función que retorna la representación en bytes de un header
+func (h Header) Bytes() []byte {
+	var buffer []byte = make([]byte, HEADER_SIZE)
+	buffer[0] = byte(h.Command)
+	buffer[1] = byte(h.Channel)
+	binary.LittleEndian.PutUint64(buffer[2:], uint64(h.Length))
+	return buffer
+}
+
+//Función que retorna el header correspondiente a un mensaje
+func (f Frame) Header() Header {
+	return Header{Command: f.Command, Channel: f.Channel, Length: int64(len(f.Body))}
+}
+
+//Función que retorna la representación en bytes de un mensaje completo
+func (f Frame) Bytes() []byte {
+	return append(f.Header().Bytes(), f.Body...)
+}
+
+//Función que parsea un header a partir de sus bytes (se asume que el buffer tiene HEADER_SIZE bytes)
+func parseHeader(buffer []byte) Header {
+	return Header{
+		Command: int8(buffer[0]),
+		Channel: int8(buffer[1]),
+		Length:  int64(binary.LittleEndian.Uint64(buffer[2:HEADER_SIZE])),
+	}
+}
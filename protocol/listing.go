@@ -0,0 +1,39 @@
+package protocol
+
+//Archivo con la estructura de las respuestas (en JSON, dentro de un COMMAND_NOTIFY_SUCCESS) a los comandos
+//COMMAND_LIST_CHANNELS y COMMAND_LIST_SUBSCRIBERS
+
+import (
+	"time"
+)
+
+//Respuesta a COMMAND_LIST_CHANNELS
+type ChannelList struct {
+	Channels []ChannelInfo `json:"channels"`
+}
+
+//Canal (o patrón de canales con suscripciones) y su cantidad de suscriptores
+type ChannelInfo struct {
+	Name        string `json:"name"`
+	Pattern     bool   `json:"pattern,omitempty"` //Indica si se trata de un patrón de canales (ej. "builds/*")
+	Subscribers int    `json:"subscribers"`
+}
+
+//Respuesta a COMMAND_LIST_SUBSCRIBERS
+type SubscriberList struct {
+	Channel     string           `json:"channel"`
+	Subscribers []SubscriberInfo `json:"subscribers"`
+}
+
+//Suscriptor de un canal
+type SubscriberInfo struct {
+	Address string `json:"address"`
+	Owner   string `json:"owner,omitempty"` //Identidad del cliente que creó la suscripción
+	//Identidad del certificado de cliente con el que se suscribió (el suscriptor debe presentar un certificado con
+	//la misma identidad al recibir los archivos)
+	Certificate string              `json:"certificate,omitempty"`
+	Since       time.Time           `json:"since"`             //Momento de la suscripción
+	Expires     *time.Time          `json:"expires,omitempty"` //Vencimiento del lease (nil: sin vencimiento)
+	Filter      *SubscriptionFilter `json:"filter,omitempty"`
+	Digest      bool                `json:"digest,omitempty"` //Indica si recibe los archivos con su digest
+}
@@ -0,0 +1,31 @@
+package protocol
+
+//Archivo con la estructura del reporte de entrega de un archivo, que el servidor envía (como JSON) en un mensaje
+//COMMAND_REPORT, ya sea al terminar un COMMAND_SEND_REPORTED o como respuesta a un COMMAND_RECEIPT
+
+//Estados posibles de la entrega a un suscriptor
+const (
+	DELIVERY_DELIVERED = "delivered" //El suscriptor confirmó la recepción
+	DELIVERY_FAILED    = "failed"    //El suscriptor rechazó el archivo o el envío falló sin posibilidad de reintento
+	DELIVERY_QUEUED    = "queued"    //El envío falló y quedó en la cola de envíos pendientes para reintentarse
+	DELIVERY_PENDING   = "pending"   //El envío aún no termina
+	DELIVERY_SKIPPED   = "skipped"   //El archivo no pasó el filtro de la suscripción, por lo que no se envió
+)
+
+//Reporte de entrega de un archivo a los suscriptores de un canal
+type DeliveryReport struct {
+	TransferID  string             `json:"transfer_id"`
+	Filename    string             `json:"filename"`
+	Channel     string             `json:"channel"`
+	Delivered   int                `json:"delivered"`
+	Total       int                `json:"total"`             //Cantidad de suscriptores (incluyendo a los omitidos)
+	Skipped     int                `json:"skipped,omitempty"` //Suscriptores omitidos por el filtro de su suscripción
+	Subscribers []SubscriberStatus `json:"subscribers"`
+}
+
+//Estado de la entrega a un suscriptor
+type SubscriberStatus struct {
+	Address string `json:"address"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"` //Motivo del fallo (el contenido del notify-failure del cliente, si lo hubo) o de la omisión
+}
@@ -0,0 +1,136 @@
+package protocol
+
+//Archivo con el formato del contenido de los mensajes de suscripción: la dirección del cliente (IP:PORT), seguida
+//opcionalmente de un salto de línea y un objeto JSON con opciones de la suscripción
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path"
+	"strings"
+	"time"
+)
+
+//Constantes
+const SUBSCRIPTION_MAX_LENGTH = 64 * 1024 //Longitud máxima del contenido de un mensaje de suscripción (dirección + opciones)
+
+//Error retornado cuando las opciones de una suscripción no son válidas
+var ErrInvalidOptions = errors.New("invalid subscription options")
+
+//Opciones de una suscripción
+type SubscribeOptions struct {
+	Lease  string              `json:"lease,omitempty"`  //Duración de la suscripción (ej. "10m"). Vacío: la suscripción no vence
+	Filter *SubscriptionFilter `json:"filter,omitempty"` //Archivos que se quieren recibir. nil: todos
+	//Indica si los mensajes send con los archivos deben terminar con el digest SHA-256 del contenido (DIGEST_SIZE
+	//bytes después del archivo, incluidos en la longitud del mensaje)
+	Digest bool `json:"digest,omitempty"`
+}
+
+//Filtro de los archivos que recibe un suscriptor (cada criterio vacío acepta cualquier archivo)
+type SubscriptionFilter struct {
+	Names        []string `json:"names,omitempty"`         //Globs del nombre del archivo (ej. "*.pdf"); basta con que coincida uno
+	MinSize      int64    `json:"min_size,omitempty"`      //Tamaño mínimo en bytes
+	MaxSize      int64    `json:"max_size,omitempty"`      //Tamaño máximo en bytes (0: sin límite)
+	ContentTypes []string `json:"content_types,omitempty"` //Tipos de contenido (ej. "application/pdf" o "image/*")
+}
+
+//Función que retorna el contenido de un mensaje de suscripción
+func EncodeSubscription(address string, options SubscribeOptions) []byte {
+	var body []byte = []byte(address)
+	if options == (SubscribeOptions{}) {
+		return body
+	}
+	encodedOptions, _ := json.Marshal(options)
+	return append(append(body, '\n'), encodedOptions...)
+}
+
+//Función que separa el contenido de un mensaje de suscripción en la dirección y las opciones
+func DecodeSubscription(body []byte) (string, SubscribeOptions, error) {
+	var options SubscribeOptions
+	var separator int = bytes.IndexByte(body, '\n')
+	if separator < 0 {
+		return string(body), options, nil
+	}
+	var decoder *json.Decoder = json.NewDecoder(bytes.NewReader(body[separator+1:]))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&options); err != nil {
+		return "", options, ErrInvalidOptions
+	}
+	if _, err := options.LeaseDuration(); err != nil {
+		return "", options, err
+	}
+	if !options.Filter.IsValid() {
+		return "", options, ErrInvalidOptions
+	}
+	return string(body[:separator]), options, nil
+}
+
+//Función que retorna la duración de la suscripción (0 si no vence)
+func (o SubscribeOptions) LeaseDuration() (time.Duration, error) {
+	if o.Lease == "" {
+		return 0, nil
+	}
+	lease, err := time.ParseDuration(o.Lease)
+	if err != nil || lease <= 0 {
+		return 0, ErrInvalidOptions
+	}
+	return lease, nil
+}
+
+//Función que indica si un filtro es válido (globs con sintaxis correcta, rango de tamaños coherente y tipos de
+//contenido de la forma "tipo/subtipo")
+func (f *SubscriptionFilter) IsValid() bool {
+	if f == nil {
+		return true
+	}
+	for _, glob := range f.Names {
+		if _, err := path.Match(glob, ""); err != nil || glob == "" {
+			return false
+		}
+	}
+	if f.MinSize < 0 || f.MaxSize < 0 || (f.MaxSize > 0 && f.MaxSize < f.MinSize) {
+		return false
+	}
+	for _, contentType := range f.ContentTypes {
+		parts := strings.Split(contentType, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" || parts[0] == "*" {
+			return false
+		}
+	}
+	return true
+}
+
+//Función que indica si un archivo pasa el filtro. Si no lo pasa, retorna además el criterio que no cumple
+//("name", "size" o "content type"). Un filtro nil acepta cualquier archivo
+func (f *SubscriptionFilter) Match(filename string, size int64, contentType string) (bool, string) {
+	if f == nil {
+		return true, ""
+	}
+	if len(f.Names) > 0 && !matchAny(f.Names, func(glob string) bool {
+		matched, _ := path.Match(glob, filename)
+		return matched
+	}) {
+		return false, "name"
+	}
+	if size < f.MinSize || (f.MaxSize > 0 && size > f.MaxSize) {
+		return false, "size"
+	}
+	if len(f.ContentTypes) > 0 && !matchAny(f.ContentTypes, func(accepted string) bool {
+		return strings.EqualFold(accepted, contentType) || (strings.HasSuffix(accepted, "/*") &&
+			strings.HasPrefix(strings.ToLower(contentType), strings.ToLower(strings.TrimSuffix(accepted, "*"))))
+	}) {
+		return false, "content type"
+	}
+	return true, ""
+}
+
+//Función que indica si algún elemento de la lista cumple la condición
+func matchAny(list []string, condition func(string) bool) bool {
+	for _, element := range list {
+		if condition(element) {
+			return true
+		}
+	}
+	return false
+}
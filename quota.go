@@ -0,0 +1,43 @@
+package main
+
+//Archivo con el control de la cuota de disco por canal: cada archivo recibido reserva su tamaño en la cuota de su
+//canal mientras permanece en el directorio de spool, y cada envío pendiente mientras permanece en la cola
+
+import (
+	"sync"
+)
+
+//Registro global del espacio de spool usado por cada canal
+var spoolUsage *channelQuota = newChannelQuota()
+
+type channelQuota struct {
+	mutex sync.Mutex
+	used  map[string]int64 //Bytes reservados por canal
+}
+
+//Función que retorna un nuevo registro de cuota vacío
+func newChannelQuota() *channelQuota {
+	return &channelQuota{used: make(map[string]int64)}
+}
+
+//Función que intenta reservar bytes en la cuota de un canal. Retorna false si la reserva excede el límite
+//(un límite de 0 indica que no hay cuota)
+func (q *channelQuota) reserve(channel string, size int64, limit int64) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if limit > 0 && q.used[channel]+size > limit {
+		return false
+	}
+	q.used[channel] += size
+	return true
+}
+
+//Función que libera bytes reservados en la cuota de un canal
+func (q *channelQuota) release(channel string, size int64) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.used[channel] -= size
+	if q.used[channel] <= 0 {
+		delete(q.used, channel)
+	}
+}
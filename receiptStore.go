@@ -0,0 +1,146 @@
+package main
+
+//Archivo con el almacenamiento de los recibos de entrega. Cada archivo aceptado recibe un ID de transferencia y su
+//estado de entrega por suscriptor se guarda en <data-directory>/receipts/<id>.json, de manera que se pueda consultar
+//aunque el cliente que lo envió ya se haya desconectado (o el servidor se haya reiniciado)
+
+import (
+	"Server/protocol"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+//Constantes
+const RECEIPTS_DIRECTORY = "receipts"       //Subdirectorio (del directorio de datos) con los recibos de entrega
+const TRANSFER_ID_LENGTH = 16               //Cantidad de bytes aleatorios de un ID de transferencia
+const RECEIPTS_CLEANUP_INTERVAL = time.Hour //Cada cuánto se eliminan los recibos más antiguos que la retención
+
+//Error retornado al consultar un ID de transferencia que no existe
+var errUnknownTransfer = errors.New("unknown transfer id")
+
+//Almacenamiento global de recibos (se inicializa en main)
+var receipts *receiptStore
+
+type receiptStore struct {
+	mutex     sync.Mutex
+	directory string
+}
+
+//Función que abre el almacenamiento de recibos en el directorio de datos
+func openReceiptStore(dataDirectory string) (*receiptStore, error) {
+	var store *receiptStore = &receiptStore{directory: filepath.Join(dataDirectory, RECEIPTS_DIRECTORY)}
+	if err := os.MkdirAll(store.directory, 0700); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+//Función que genera un nuevo ID de transferencia
+func newTransferID() string {
+	var buffer []byte = make([]byte, TRANSFER_ID_LENGTH)
+	if _, err := rand.Read(buffer); err != nil {
+		//Sin fuente aleatoria se usa la hora actual (sigue siendo único dentro del proceso)
+		return fmt.Sprintf("%032x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buffer)
+}
+
+//Función que indica si un texto tiene el formato de un ID de transferencia
+func isValidTransferID(id string) bool {
+	decoded, err := hex.DecodeString(id)
+	return err == nil && len(decoded) == TRANSFER_ID_LENGTH
+}
+
+//Función que guarda (o reemplaza) el recibo de una transferencia
+func (s *receiptStore) save(report protocol.DeliveryReport) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.write(report)
+}
+
+//Función que retorna el recibo de una transferencia
+func (s *receiptStore) load(id string) (protocol.DeliveryReport, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.read(id)
+}
+
+//Función que actualiza el estado de entrega de un suscriptor en el recibo de una transferencia
+func (s *receiptStore) updateSubscriber(id string, address string, status string, reason string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	report, err := s.read(id)
+	if err != nil {
+		return
+	}
+	for i := range report.Subscribers {
+		if report.Subscribers[i].Address == address {
+			report.Subscribers[i].Status = status
+			report.Subscribers[i].Reason = reason
+		}
+	}
+	report.Delivered = 0
+	for _, subscriber := range report.Subscribers {
+		if subscriber.Status == protocol.DELIVERY_DELIVERED {
+			report.Delivered++
+		}
+	}
+	if err := s.write(report); err != nil {
+		fmt.Println("ERROR: Error while updating delivery receipt: " + err.Error())
+	}
+}
+
+//Función que elimina los recibos más antiguos que la retención indicada
+func (s *receiptStore) cleanup(retention time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	paths, err := filepath.Glob(filepath.Join(s.directory, "*.json"))
+	if err != nil {
+		return
+	}
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > retention {
+			os.Remove(path)
+		}
+	}
+}
+
+//Función que lee un recibo (se asume que se tiene el lock)
+func (s *receiptStore) read(id string) (protocol.DeliveryReport, error) {
+	var report protocol.DeliveryReport
+	if !isValidTransferID(id) {
+		return report, errUnknownTransfer
+	}
+	data, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return report, errUnknownTransfer
+	} else if err != nil {
+		return report, err
+	}
+	err = json.Unmarshal(data, &report)
+	return report, err
+}
+
+//Función que escribe un recibo de manera atómica (se asume que se tiene el lock)
+func (s *receiptStore) write(report protocol.DeliveryReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	var temporaryPath string = s.path(report.TransferID) + ".tmp"
+	if err := os.WriteFile(temporaryPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(temporaryPath, s.path(report.TransferID))
+}
+
+func (s *receiptStore) path(id string) string {
+	return filepath.Join(s.directory, id+".json")
+}
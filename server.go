@@ -3,41 +3,167 @@ package main
 //Archivo con la función main del servidor.
 
 import (
+	"crypto/tls"
+	"flag"
 	"fmt"
 	"net"
 	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
-//Constantes
-const NUMBER_OF_CHANNELS = 8          //Cantidad de canales disponibles para que un cliente se suscriba
-const BUFFER_SIZE = 1024              //Tamaño de buffer temporal para recibir contenidos de mensaje largos (archivos)
-const LISTENER_PORT = "7101"          //Puerto sobre el que recibirá mensajes el servidor
-const FILENAME_MAX_LENGTH = 40        //Tamaño máximo del nombre de un archivo que se recibe
-const SEND_FILES_CONCURRENTLY = false //Determina si un archivo recibido se envía a los clientes de un canal de manera concurrente o secuencial
-
 func main() {
 	//Verificar argumentos
-	if len(os.Args) != 2 || os.Args[1] != "start" {
+	if len(os.Args) < 2 || os.Args[1] != "start" {
 		fmt.Print("File sharing server: Allow clients to send and receive files through channel subscriptions\n\n")
 		fmt.Println("Usage:")
-		fmt.Println("server start")
+		fmt.Println("server start [options]   (run \"server start -h\" to list the options)")
+		os.Exit(0)
+	}
+
+	//Cargar la configuración (archivo de configuración, variables de entorno y flags)
+	var configError error
+	config, configError = loadConfig(os.Args[2:])
+	//Error check
+	if configError == flag.ErrHelp {
 		os.Exit(0)
+	} else if configError != nil {
+		fmt.Println("ERROR: Invalid configuration: " + configError.Error())
+		os.Exit(2)
 	}
+	config.print()
+	//Cargar las redes en las que se aceptan suscriptores (la configuración ya se validó). Se cargan antes de restaurar
+	//las suscripciones porque también se aplican a ellas
+	subscriberAllowList, _ = parseNetworks(config.SubscriberAllowList)
 
-	//Inicializar matriz que contendrá a los clientes conectados a cada canal
-	var subsMatrix *subscriptionMatrix = newSubscriptionMatrix()
+	//Inicializar el registro de canales (con los canales numerados) que contendrá a los clientes suscritos a cada canal
+	var registry *channelRegistry = newChannelRegistry(config.NumberOfChannels, config.MaxChannels)
+	//Restaurar las suscripciones almacenadas
+	store, storedSubscriptions, storeError := openSubscriptionStore(config.DataDirectory)
+	//Error check
+	if storeError != nil {
+		fmt.Println("ERROR: Error while opening subscriptions store: " + storeError.Error())
+		return
+	}
+	registry.attachStore(store, storedSubscriptions)
+	fmt.Printf("Restored %d channel/subscription record(s) from %v\n", len(storedSubscriptions), config.DataDirectory)
+	//Retirar las suscripciones cuyo lease vence
+	go registry.runExpiry()
+	//Monitorear la salud de los suscriptores (sondeándolos periódicamente si está configurado)
+	subscriberHealth = newHealthMonitor(registry)
+	if config.HealthCheckInterval.Duration > 0 {
+		go subscriberHealth.run()
+	}
+	//Abrir el almacenamiento de recibos de entrega y eliminar periódicamente los antiguos
+	var receiptsError error
+	receipts, receiptsError = openReceiptStore(config.DataDirectory)
+	//Error check
+	if receiptsError != nil {
+		fmt.Println("ERROR: Error while opening delivery receipts store: " + receiptsError.Error())
+		return
+	}
+	go func() {
+		receipts.cleanup(config.ReceiptRetention.Duration)
+		for range time.Tick(RECEIPTS_CLEANUP_INTERVAL) {
+			receipts.cleanup(config.ReceiptRetention.Duration)
+		}
+	}()
+	//Abrir la cola de envíos pendientes y empezar a reintentarlos
+	var queueError error
+	offlineQueue, queueError = openDeliveryQueue(config.DataDirectory, registry)
+	//Error check
+	if queueError != nil {
+		fmt.Println("ERROR: Error while opening delivery queue: " + queueError.Error())
+		return
+	}
+	go offlineQueue.run()
+	//Escribir snapshots de las suscripciones periódicamente
+	go func() {
+		for range time.Tick(config.SnapshotInterval.Duration) {
+			if err := registry.snapshot(); err != nil {
+				fmt.Println("ERROR: Error while writing subscriptions snapshot: " + err.Error())
+			}
+		}
+	}()
 
-	//Iniciar servidor en localhost y el puerto específico
+	//Cargar las credenciales de los clientes
+	if config.CredentialsFile != "" {
+		var credentialsError error
+		credentials, credentialsError = loadCredentials(config.CredentialsFile)
+		//Error check
+		if credentialsError != nil {
+			fmt.Println("ERROR: Error while loading credentials: " + credentialsError.Error())
+			return
+		}
+		fmt.Printf("Loaded %d credential(s) from %v\n", len(credentials.tokens), config.CredentialsFile)
+	}
+	//Cargar las reglas de acceso de los canales
+	if config.ACLFile != "" {
+		var rulesError error
+		accessRules, rulesError = loadAccessRules(config.ACLFile)
+		//Error check
+		if rulesError != nil {
+			fmt.Println("ERROR: Error while loading access rules: " + rulesError.Error())
+			return
+		}
+		fmt.Printf("Loaded access rules for %d channel(s) from %v\n", len(accessRules.rules.Channels), config.ACLFile)
+	}
+	go reloadOnHangup()
+	//Cargar la configuración TLS del listener y de los envíos a los suscriptores
+	listenerTLS, tlsError := listenerTLSConfig()
+	if tlsError == nil {
+		deliveryTLS, tlsError = deliveryTLSConfig()
+	}
+	//Error check
+	if tlsError != nil {
+		fmt.Println("ERROR: Error while loading TLS configuration: " + tlsError.Error())
+		return
+	}
+
+	//Preparar el directorio donde se almacenarán temporalmente los archivos recibidos
+	if spoolError := prepareSpoolDirectory(); spoolError != nil {
+		fmt.Println("ERROR: Error while preparing spool directory: " + spoolError.Error())
+		return
+	}
+
+	//Iniciar servidor en la dirección y el puerto configurados
 	var listener net.Listener
 	var listenerError error
-	listener, listenerError = net.Listen("tcp", "127.0.0.1:"+LISTENER_PORT)
+	listener, listenerError = net.Listen("tcp", net.JoinHostPort(config.BindAddress, strconv.Itoa(config.ListenerPort)))
 	//Error check
 	if listenerError != nil {
 		fmt.Println("ERROR: Error while starting server: " + listenerError.Error())
 		return
 	}
+	//Usar TLS en el listener si se configuró un certificado
+	if listenerTLS != nil {
+		listener = tls.NewListener(listener, listenerTLS)
+	}
+
+	//Apagar el servidor ordenadamente al recibir SIGINT/SIGTERM (una segunda señal fuerza la salida)
+	var shuttingDown int32 = 0
+	var signals chan os.Signal = make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		receivedSignal := <-signals
+		fmt.Printf("Received %v. Shutting down (waiting up to %v for in-flight transfers)...\n", receivedSignal, config.ShutdownTimeout.Duration)
+		atomic.StoreInt32(&shuttingDown, 1)
+		listener.Close()
+		<-signals
+		fmt.Println("Received second signal. Exiting immediately")
+		os.Exit(1)
+	}()
 
-	fmt.Println("Server started on port " + LISTENER_PORT + ". Awaiting connections...")
+	if listenerTLS != nil {
+		fmt.Println("Server started on " + listener.Addr().String() + " (TLS). Awaiting connections...")
+	} else {
+		fmt.Println("Server started on " + listener.Addr().String() + ". Awaiting connections...")
+	}
+	var fatalError bool = false      //Indica si el listener falló de manera irrecuperable
+	var retryDelay time.Duration = 0 //Espera actual antes de reintentar un Accept que falló temporalmente
 	//Quedar a la espera de conexiones entrantes
 	for {
 		var connection net.Conn
@@ -46,12 +172,62 @@ func main() {
 		connection, connectionError = listener.Accept()
 		//Error check
 		if connectionError != nil {
-			fmt.Println("ERROR: Error while accepting incoming connection: " + connectionError.Error())
-			os.Exit(1)
+			if atomic.LoadInt32(&shuttingDown) == 1 {
+				break
+			}
+			//Los errores temporales se reintentan con backoff exponencial
+			if isTemporaryAcceptError(connectionError) {
+				retryDelay = nextAcceptRetryDelay(retryDelay)
+				fmt.Printf("WARNING: Temporary error while accepting incoming connection: %v (retrying in %v)\n", connectionError, retryDelay)
+				time.Sleep(retryDelay)
+				continue
+			}
+			fmt.Println("ERROR: Fatal error while accepting incoming connection: " + connectionError.Error() + ". Shutting down...")
+			fatalError = true
+			break
 		}
+		retryDelay = 0
 
 		//Interactuar con el cliente en otro goroutine (es decir, de manera concurrente)
-		go handleConnection(connection, subsMatrix)
+		go handleConnection(connection, registry)
+	}
+
+	//Esperar a que terminen las transferencias en curso (o cancelarlas al vencer el tiempo de espera)
+	var aborted []string = transfers.drain(config.ShutdownTimeout.Duration)
+	if len(aborted) > 0 {
+		fmt.Printf("Shutdown timeout reached. Aborted %d transfer(s):\n", len(aborted))
+		for _, description := range aborted {
+			fmt.Println("  - " + description)
+		}
+	} else {
+		fmt.Println("All transfers finished")
+	}
+	//Guardar un snapshot final de las suscripciones
+	if err := registry.snapshot(); err != nil {
+		fmt.Println("ERROR: Error while writing subscriptions snapshot: " + err.Error())
 	}
+	store.close()
+	fmt.Println("Server stopped")
+	if fatalError || len(aborted) > 0 {
+		os.Exit(1)
+	}
+}
 
+//Función que vuelve a cargar las credenciales y las reglas de acceso cada vez que se recibe SIGHUP
+func reloadOnHangup() {
+	var hangups chan os.Signal = make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	for range hangups {
+		fmt.Println("Received SIGHUP. Reloading credentials and access rules...")
+		if credentials != nil {
+			if err := credentials.reload(); err != nil {
+				fmt.Println("ERROR: Error while reloading credentials (keeping the previous ones): " + err.Error())
+			}
+		}
+		if accessRules != nil {
+			if err := accessRules.reload(); err != nil {
+				fmt.Println("ERROR: Error while reloading access rules (keeping the previous ones): " + err.Error())
+			}
+		}
+	}
 }
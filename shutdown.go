@@ -0,0 +1,123 @@
+package main
+
+//Archivo con el registro de transferencias en curso, usado para apagar el servidor ordenadamente: al recibir una
+//señal de terminación se deja de aceptar conexiones y se espera a que terminen las transferencias activas
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+//Registro global de transferencias en curso (conexiones atendidas y envíos a suscriptores)
+var transfers *transferRegistry = newTransferRegistry()
+
+//Transferencia en curso
+type activeTransfer struct {
+	description string
+	connection  net.Conn //Conexión de la transferencia (cerrarla cancela la transferencia). Puede ser nil
+}
+
+type transferRegistry struct {
+	mutex     sync.Mutex
+	nextID    int64
+	active    map[int64]*activeTransfer
+	changed   chan struct{} //Recibe una notificación cada vez que termina una transferencia
+	cancelled bool          //Indica si se cancelaron las transferencias restantes (no se aceptan nuevas)
+}
+
+//Función que retorna un nuevo registro vacío
+func newTransferRegistry() *transferRegistry {
+	return &transferRegistry{
+		active:  make(map[int64]*activeTransfer),
+		changed: make(chan struct{}, 1),
+	}
+}
+
+//Función que registra el inicio de una transferencia. Retorna false si el servidor ya canceló las transferencias
+func (r *transferRegistry) begin(description string, connection net.Conn) (int64, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.cancelled {
+		return 0, false
+	}
+	r.nextID++
+	r.active[r.nextID] = &activeTransfer{description: description, connection: connection}
+	return r.nextID, true
+}
+
+//Función que actualiza la descripción de una transferencia
+func (r *transferRegistry) describe(id int64, description string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if transfer, found := r.active[id]; found {
+		transfer.description = description
+	}
+}
+
+//Función que asocia una conexión a una transferencia ya registrada. Retorna false si la transferencia fue cancelada
+//(en ese caso la conexión debe cerrarse)
+func (r *transferRegistry) attach(id int64, connection net.Conn) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.cancelled {
+		return false
+	}
+	if transfer, found := r.active[id]; found {
+		transfer.connection = connection
+	}
+	return true
+}
+
+//Función que indica si el servidor canceló las transferencias en curso
+func (r *transferRegistry) isCancelled() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.cancelled
+}
+
+//Función que registra el fin de una transferencia
+func (r *transferRegistry) end(id int64) {
+	r.mutex.Lock()
+	delete(r.active, id)
+	r.mutex.Unlock()
+	//Notificar sin bloquear (basta con una notificación pendiente)
+	select {
+	case r.changed <- struct{}{}:
+	default:
+	}
+}
+
+//Función que espera a que terminen las transferencias en curso. Si no terminan dentro del tiempo indicado se
+//cancelan cerrando sus conexiones, y se retornan las descripciones de las transferencias canceladas
+func (r *transferRegistry) drain(timeout time.Duration) []string {
+	var deadline <-chan time.Time = time.After(timeout)
+	for {
+		r.mutex.Lock()
+		var remaining int = len(r.active)
+		r.mutex.Unlock()
+		if remaining == 0 {
+			return nil
+		}
+		select {
+		case <-r.changed:
+		case <-deadline:
+			return r.cancelAll()
+		}
+	}
+}
+
+//Función que cancela todas las transferencias en curso
+func (r *transferRegistry) cancelAll() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.cancelled = true
+	var aborted []string
+	for _, transfer := range r.active {
+		aborted = append(aborted, transfer.description)
+		if transfer.connection != nil {
+			transfer.connection.Close()
+		}
+	}
+	return aborted
+}
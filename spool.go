@@ -0,0 +1,181 @@
+package main
+
+//Archivo con las funciones que permiten almacenar temporalmente en disco (spool) los archivos recibidos, de manera que
+//la memoria usada por cada transferencia no dependa del tamaño del archivo
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+//Archivo recibido de un cliente y almacenado en el directorio de spool, listo para enviarse a los suscriptores
+type spooledFile struct {
+	path       string         //Ruta del archivo temporal
+	transferID string         //ID de la transferencia (para consultar su recibo de entrega)
+	name       string         //Nombre del archivo (sin el relleno del campo del protocolo)
+	filename   []byte         //Nombre del archivo tal como se recibió (config.FilenameMaxLength bytes)
+	channel    string         //Canal por el que se envió el archivo
+	size       int64          //Tamaño del contenido del archivo
+	digest     []byte         //Digest SHA-256 del contenido recibido (se calcula al terminar la recepción)
+	progress   *spoolProgress //Progreso de la recepción (solo en modo pipeline, nil si el archivo ya se recibió completo)
+}
+
+//Estado de la escritura de un archivo en el spool. Permite que los envíos lean el archivo mientras aún se recibe
+type spoolProgress struct {
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	written int64 //Cantidad de bytes escritos hasta el momento
+	done    bool  //Indica si la recepción terminó
+	err     error //Error con el que terminó la recepción (nil si se recibió completo)
+	//Cantidad de bytes que se pueden leer antes de que la recepción termine sin errores (-1: todos los escritos). Los
+	//bytes posteriores se retienen, por ejemplo, hasta comprobar el digest del archivo
+	held int64
+}
+
+//Writer que escribe en el archivo temporal y notifica a los lectores los bytes nuevos
+type spoolWriter struct {
+	file     *os.File
+	progress *spoolProgress
+}
+
+//Reader que lee el archivo temporal conforme se escribe, esperando cuando alcanza al escritor
+type spoolTailReader struct {
+	file     *os.File
+	progress *spoolProgress
+	offset   int64
+}
+
+//Función que prepara el directorio de spool, eliminando archivos temporales que hayan quedado de ejecuciones anteriores
+func prepareSpoolDirectory() error {
+	if err := os.MkdirAll(config.SpoolDirectory, 0700); err != nil {
+		return err
+	}
+	leftovers, err := filepath.Glob(filepath.Join(config.SpoolDirectory, "upload-*.spool"))
+	if err != nil {
+		return err
+	}
+	for _, path := range leftovers {
+		os.Remove(path)
+	}
+	return nil
+}
+
+//Función que crea un nuevo archivo temporal en el directorio de spool
+func createSpoolFile() (*os.File, error) {
+	return os.CreateTemp(config.SpoolDirectory, "upload-*.spool")
+}
+
+//Función que abre el archivo temporal para leer su contenido (cada envío usa su propio descriptor). En modo pipeline
+//el reader retornado espera a que lleguen los bytes que aún no se han recibido
+func (f *spooledFile) open() (io.ReadCloser, error) {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, err
+	}
+	if f.progress == nil {
+		return file, nil
+	}
+	return &spoolTailReader{file: file, progress: f.progress}, nil
+}
+
+//Función que retorna la descripción del envío del archivo a un cliente
+func (f *spooledFile) deliveryDescription(clientAddress string) string {
+	return fmt.Sprintf("delivery of \"%v\" (channel %v) to %v", f.name, f.channel, clientAddress)
+}
+
+//Función que elimina el archivo temporal una vez que ya no es necesario, liberando su espacio en la cuota del canal
+func (f *spooledFile) remove() {
+	if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+		fmt.Println("ERROR: Error while removing spool file: " + err.Error())
+	}
+	spoolUsage.release(f.channel, f.size)
+}
+
+//Función que retorna un nuevo estado de escritura que retiene los bytes posteriores a held hasta que la recepción
+//termine sin errores (-1: no se retiene ningún byte)
+func newSpoolProgress(held int64) *spoolProgress {
+	var progress *spoolProgress = &spoolProgress{held: held}
+	progress.cond = sync.NewCond(&progress.mutex)
+	return progress
+}
+
+//Función que retorna cuántos bytes se pueden leer en este momento (se debe llamar con el mutex bloqueado)
+func (p *spoolProgress) readable() int64 {
+	if p.held < 0 || (p.done && p.err == nil) || p.written < p.held {
+		return p.written
+	}
+	return p.held
+}
+
+//Función que registra bytes nuevos escritos en el archivo y despierta a los lectores
+func (p *spoolProgress) advance(n int64) {
+	p.mutex.Lock()
+	p.written += n
+	p.mutex.Unlock()
+	p.cond.Broadcast()
+}
+
+//Función que marca el fin de la recepción (err nil indica que el archivo se recibió completo)
+func (p *spoolProgress) finish(err error) {
+	p.mutex.Lock()
+	p.done = true
+	p.err = err
+	p.mutex.Unlock()
+	p.cond.Broadcast()
+}
+
+//Función que espera a que termine la recepción y retorna el error con el que terminó (nil si se recibió completo)
+func (p *spoolProgress) result() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for !p.done {
+		p.cond.Wait()
+	}
+	return p.err
+}
+
+//Función que espera hasta que existan bytes legibles después de offset y retorna cuántos hay disponibles. Si la
+//recepción ya terminó y no hay más bytes retorna io.EOF (o el error con el que terminó, como deliveryAbortedError)
+func (p *spoolProgress) wait(offset int64) (int64, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for offset >= p.readable() && !p.done {
+		p.cond.Wait()
+	}
+	if readable := p.readable(); offset < readable {
+		return readable - offset, nil
+	}
+	if p.err != nil {
+		return 0, &deliveryAbortedError{cause: p.err}
+	}
+	return 0, io.EOF
+}
+
+func (w *spoolWriter) Write(buffer []byte) (int, error) {
+	n, err := w.file.Write(buffer)
+	w.progress.advance(int64(n))
+	return n, err
+}
+
+func (r *spoolTailReader) Read(buffer []byte) (int, error) {
+	available, err := r.progress.wait(r.offset)
+	if available == 0 {
+		return 0, err
+	}
+	if int64(len(buffer)) > available {
+		buffer = buffer[:available]
+	}
+	n, err := r.file.ReadAt(buffer, r.offset)
+	r.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *spoolTailReader) Close() error {
+	return r.file.Close()
+}
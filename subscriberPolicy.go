@@ -0,0 +1,119 @@
+package main
+
+//Archivo con la política que determina qué direcciones se aceptan como suscriptores. Como el servidor se conecta a la
+//dirección indicada en la suscripción para enviar los archivos, aceptar cualquier dirección permitiría usarlo para
+//enviar datos a hosts y puertos internos arbitrarios
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+//Políticas de direcciones de suscriptores
+const (
+	SUBSCRIBER_POLICY_PEER       = "peer"       //La dirección debe tener la IP del cliente que se suscribe (o estar en la allow-list)
+	SUBSCRIBER_POLICY_ALLOW_LIST = "allow-list" //La dirección debe estar en la allow-list
+	SUBSCRIBER_POLICY_OPEN       = "open"       //Se acepta cualquier dirección
+)
+
+//Redes en las que se aceptan suscriptores (subscriber-allow-list). Se inicializa en main
+var subscriberAllowList []*net.IPNet
+
+//Error retornado cuando una dirección de suscriptor no cumple la política
+type subscriberPolicyError struct {
+	reason string
+}
+
+func (e *subscriberPolicyError) Error() string {
+	return "subscriber address rejected: " + e.reason
+}
+
+//Función que comprueba que una dirección de suscriptor cumpla la política configurada, considerando la dirección desde
+//la que se conectó el cliente que se suscribe. Con peer nil (suscripciones restauradas y envíos pendientes, de los
+//que no se conoce el cliente) no se compara con la IP del cliente, pero sí se aplican las demás comprobaciones
+func checkSubscriberAddress(address string, peer net.Addr) error {
+	if config.SubscriberPolicy == SUBSCRIBER_POLICY_OPEN && !config.DenyInternalSubscribers {
+		return nil
+	}
+	//La dirección debe ser una IP (un nombre podría resolverse a otra dirección al momento de enviar los archivos)
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return &subscriberPolicyError{reason: "invalid address"}
+	}
+	if portNumber, err := strconv.Atoi(port); err != nil || portNumber < 1 || portNumber > 65535 {
+		return &subscriberPolicyError{reason: "invalid port"}
+	}
+	var ip net.IP = net.ParseIP(host)
+	if ip == nil {
+		return &subscriberPolicyError{reason: "not an IP address"}
+	}
+	if config.DenyInternalSubscribers && isInternalIP(ip) {
+		return &subscriberPolicyError{reason: "loopback and link-local addresses are denied"}
+	}
+	if config.SubscriberPolicy == SUBSCRIBER_POLICY_OPEN || inNetworks(ip, subscriberAllowList) {
+		return nil
+	}
+	if config.SubscriberPolicy == SUBSCRIBER_POLICY_ALLOW_LIST {
+		return &subscriberPolicyError{reason: "not in allow-list"}
+	}
+	if peer == nil {
+		return nil
+	}
+	peerHost, _, err := net.SplitHostPort(peer.String())
+	if err != nil || !ip.Equal(net.ParseIP(peerHost)) {
+		return &subscriberPolicyError{reason: "IP does not match the connecting client"}
+	}
+	return nil
+}
+
+//Función que indica si una IP es de loopback, link-local o no especificada
+func isInternalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsUnspecified()
+}
+
+//Función que indica si una IP pertenece a alguna de las redes
+func inNetworks(ip net.IP, networks []*net.IPNet) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+//Función que parsea una lista de redes en notación CIDR separadas por comas (ej. "10.0.0.0/8,192.168.1.0/24")
+func parseNetworks(list string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+//Función que valida las opciones de la política de suscriptores de la configuración
+func (c *serverConfig) validateSubscriberPolicy() error {
+	switch c.SubscriberPolicy {
+	case SUBSCRIBER_POLICY_PEER, SUBSCRIBER_POLICY_ALLOW_LIST, SUBSCRIBER_POLICY_OPEN:
+	default:
+		return fmt.Errorf("invalid subscriber policy %q (allowed: %v, %v, %v)", c.SubscriberPolicy, SUBSCRIBER_POLICY_PEER, SUBSCRIBER_POLICY_ALLOW_LIST, SUBSCRIBER_POLICY_OPEN)
+	}
+	networks, err := parseNetworks(c.SubscriberAllowList)
+	if err != nil {
+		return fmt.Errorf("subscriber allow-list: %w", err)
+	}
+	if c.SubscriberPolicy == SUBSCRIBER_POLICY_ALLOW_LIST && len(networks) == 0 {
+		return errors.New("subscriber policy " + SUBSCRIBER_POLICY_ALLOW_LIST + " requires subscriber-allow-list")
+	}
+	return nil
+}
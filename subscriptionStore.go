@@ -0,0 +1,214 @@
+package main
+
+//Archivo con el almacenamiento durable de las suscripciones. Cada cambio se agrega a un log (una línea JSON por
+//operación) y periódicamente se escribe un snapshot con todas las suscripciones, tras lo cual el log se vacía.
+//El snapshot se reemplaza de manera atómica (archivo temporal + rename) y una línea incompleta al final del log
+//(escritura interrumpida por una caída) se descarta al restaurar, por lo que el almacenamiento no se corrompe
+
+import (
+	"Server/protocol"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//Constantes
+const SUBSCRIPTIONS_LOG_FILE = "subscriptions.log"           //Log de operaciones de suscripción
+const SUBSCRIPTIONS_SNAPSHOT_FILE = "subscriptions.snapshot" //Snapshot con todas las suscripciones
+
+//Operaciones registradas en el log
+const (
+	RECORD_SUBSCRIBE   = "subscribe"
+	RECORD_UNSUBSCRIBE = "unsubscribe"
+	RECORD_CREATE      = "create" //Creación de un canal (sin dirección)
+	RECORD_DELETE      = "delete" //Eliminación de un canal (sin dirección)
+)
+
+//Registro de una operación (en el log) o de una suscripción (en el snapshot)
+type subscriptionRecord struct {
+	Operation string                       `json:"op"`
+	Channel   string                       `json:"channel"`
+	Address   string                       `json:"address,omitempty"`
+	Time      time.Time                    `json:"time"`
+	Expires   *time.Time                   `json:"expires,omitempty"` //Vencimiento del lease (nil: sin vencimiento)
+	Filter    *protocol.SubscriptionFilter `json:"filter,omitempty"`  //Filtro de la suscripción (nil: todos los archivos)
+	Owner     string                       `json:"owner,omitempty"`   //Identidad que creó la suscripción
+	//Identidad del certificado de cliente con el que se creó la suscripción
+	Certificate string `json:"certificate,omitempty"`
+	Digest      bool   `json:"digest,omitempty"` //Indica si el suscriptor recibe los archivos con su digest
+}
+
+type subscriptionStore struct {
+	mutex     sync.Mutex
+	directory string
+	log       *os.File
+}
+
+//Función que abre el almacenamiento en el directorio indicado y retorna las suscripciones guardadas
+func openSubscriptionStore(directory string) (*subscriptionStore, []subscriptionRecord, error) {
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return nil, nil, err
+	}
+	var store *subscriptionStore = &subscriptionStore{directory: directory}
+	//Cargar el snapshot (puede no existir)
+	var subscriptions map[string]subscriptionRecord = make(map[string]subscriptionRecord)
+	snapshotData, err := os.ReadFile(store.path(SUBSCRIPTIONS_SNAPSHOT_FILE))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, err
+	}
+	if err == nil {
+		var records []subscriptionRecord
+		if err := json.Unmarshal(snapshotData, &records); err != nil {
+			return nil, nil, fmt.Errorf("corrupted snapshot %v: %w", store.path(SUBSCRIPTIONS_SNAPSHOT_FILE), err)
+		}
+		for _, record := range records {
+			subscriptions[record.key()] = record
+		}
+	}
+	//Aplicar las operaciones del log posteriores al snapshot
+	store.log, err = os.OpenFile(store.path(SUBSCRIPTIONS_LOG_FILE), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	var validLength int64 = 0
+	var reader *bufio.Reader = bufio.NewReader(store.log)
+	for {
+		line, readError := reader.ReadBytes('\n')
+		if readError == io.EOF {
+			//Una línea sin salto de línea final quedó incompleta y se descarta
+			break
+		} else if readError != nil {
+			store.log.Close()
+			return nil, nil, readError
+		}
+		var record subscriptionRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			fmt.Println("WARNING: Discarding corrupted entries at the end of the subscriptions log")
+			break
+		}
+		validLength += int64(len(line))
+		switch record.Operation {
+		case RECORD_SUBSCRIBE, RECORD_CREATE:
+			subscriptions[record.key()] = record
+		case RECORD_UNSUBSCRIBE, RECORD_DELETE:
+			delete(subscriptions, record.key())
+		}
+	}
+	//Truncar lo que haya quedado incompleto y posicionarse al final para agregar nuevas operaciones
+	if err := store.log.Truncate(validLength); err != nil {
+		store.log.Close()
+		return nil, nil, err
+	}
+	if _, err := store.log.Seek(validLength, io.SeekStart); err != nil {
+		store.log.Close()
+		return nil, nil, err
+	}
+	var records []subscriptionRecord = make([]subscriptionRecord, 0, len(subscriptions))
+	for _, record := range subscriptions {
+		records = append(records, record)
+	}
+	return store, records, nil
+}
+
+//Función que agrega una operación al log, asegurándose de que llegue al disco
+func (s *subscriptionStore) record(record subscriptionRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, err := s.log.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return s.log.Sync()
+}
+
+//Función que reemplaza el snapshot por las suscripciones recibidas y vacía el log
+func (s *subscriptionStore) snapshot(records []subscriptionRecord) error {
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	//Escribir el snapshot en un archivo temporal y reemplazar el anterior de manera atómica
+	temporary, err := os.CreateTemp(s.directory, SUBSCRIPTIONS_SNAPSHOT_FILE+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = temporary.Write(data)
+	if err == nil {
+		err = temporary.Sync()
+	}
+	if closeError := temporary.Close(); err == nil {
+		err = closeError
+	}
+	if err == nil {
+		err = os.Rename(temporary.Name(), s.path(SUBSCRIPTIONS_SNAPSHOT_FILE))
+	}
+	if err != nil {
+		os.Remove(temporary.Name())
+		return err
+	}
+	syncDirectory(s.directory)
+	//Las operaciones del log ya están incluidas en el snapshot (si el proceso cae antes de vaciarlo, volver a
+	//aplicarlas sobre el snapshot no cambia el resultado)
+	if err := s.log.Truncate(0); err != nil {
+		return err
+	}
+	_, err = s.log.Seek(0, io.SeekStart)
+	return err
+}
+
+//Función que cierra el log
+func (s *subscriptionStore) close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.log.Close()
+}
+
+//Función que retorna la ruta de un archivo dentro del directorio del almacenamiento
+func (s *subscriptionStore) path(name string) string {
+	return filepath.Join(s.directory, name)
+}
+
+//Función que retorna la llave que identifica a una suscripción (o a un canal, cuya dirección es vacía)
+func (r subscriptionRecord) key() string {
+	return r.Channel + "|" + r.Address
+}
+
+//Función que decodifica un registro, aceptando también el formato anterior a los canales con nombre (en el que el
+//canal era un número)
+func (r *subscriptionRecord) UnmarshalJSON(data []byte) error {
+	type plainRecord subscriptionRecord
+	var decoded struct {
+		plainRecord
+		Channel json.RawMessage `json:"channel"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*r = subscriptionRecord(decoded.plainRecord)
+	var number int8
+	if err := json.Unmarshal(decoded.Channel, &number); err == nil {
+		r.Channel = strconv.Itoa(int(number))
+		return nil
+	}
+	return json.Unmarshal(decoded.Channel, &r.Channel)
+}
+
+//Función que sincroniza un directorio para que un rename sobreviva a una caída (no disponible en todos los sistemas)
+func syncDirectory(directory string) {
+	if dir, err := os.Open(directory); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+//Pruebas de la restauración del almacenamiento de suscripciones tras una caída
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+//Función que retorna la línea del log correspondiente a un registro
+func testLogLine(t *testing.T, record subscriptionRecord) []byte {
+	t.Helper()
+	line, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(line, '\n')
+}
+
+//Función que retorna las llaves de los registros restaurados, ordenadas
+func restoredKeys(records []subscriptionRecord) []string {
+	var keys []string
+	for _, record := range records {
+		keys = append(keys, record.key())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestOpenSubscriptionStoreDiscardsDamagedLogTail(t *testing.T) {
+	var now time.Time = time.Now().UTC()
+	var validLog []byte
+	validLog = append(validLog, testLogLine(t, subscriptionRecord{Operation: RECORD_CREATE, Channel: "builds", Time: now})...)
+	validLog = append(validLog, testLogLine(t, subscriptionRecord{Operation: RECORD_SUBSCRIBE, Channel: "builds", Address: "127.0.0.1:7201", Time: now})...)
+	validLog = append(validLog, testLogLine(t, subscriptionRecord{Operation: RECORD_SUBSCRIBE, Channel: "1", Address: "127.0.0.1:7202", Time: now})...)
+	validLog = append(validLog, testLogLine(t, subscriptionRecord{Operation: RECORD_UNSUBSCRIBE, Channel: "1", Address: "127.0.0.1:7202", Time: now})...)
+	var partial []byte = testLogLine(t, subscriptionRecord{Operation: RECORD_SUBSCRIBE, Channel: "builds", Address: "127.0.0.1:7203", Time: now})
+
+	var tests = []struct {
+		name string
+		tail []byte
+	}{
+		{"partial last line", partial[:len(partial)/2]},
+		{"partial line ending exactly before its newline", partial[:len(partial)-1]},
+		{"garbage last line", []byte("\x00\x00{\"op\":\"subscr\n")},
+		{"garbage followed by a valid line", append([]byte("not json\n"), partial...)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var directory string = t.TempDir()
+			var logPath string = filepath.Join(directory, SUBSCRIPTIONS_LOG_FILE)
+			if err := os.WriteFile(logPath, append(append([]byte(nil), validLog...), test.tail...), 0600); err != nil {
+				t.Fatal(err)
+			}
+			store, records, err := openSubscriptionStore(directory)
+			if err != nil {
+				t.Fatalf("openSubscriptionStore() error = %v", err)
+			}
+			//Se restauran las operaciones anteriores a la línea dañada
+			var keys []string = restoredKeys(records)
+			if len(keys) != 2 || keys[0] != "builds|" || keys[1] != "builds|127.0.0.1:7201" {
+				t.Fatalf("restored records = %v, want [builds| builds|127.0.0.1:7201]", keys)
+			}
+			//La línea dañada se trunca y las operaciones nuevas se agregan a continuación de las válidas
+			if err := store.record(subscriptionRecord{Operation: RECORD_SUBSCRIBE, Channel: "builds", Address: "127.0.0.1:7204", Time: now}); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.close(); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(logPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var expected string = string(validLog) + string(testLogLine(t, subscriptionRecord{Operation: RECORD_SUBSCRIBE, Channel: "builds", Address: "127.0.0.1:7204", Time: now}))
+			if string(data) != expected {
+				t.Fatalf("log after reopening:\n%s\nwant:\n%s", data, expected)
+			}
+			//Al volver a abrirlo se restauran todas las operaciones
+			store, records, err = openSubscriptionStore(directory)
+			if err != nil {
+				t.Fatalf("openSubscriptionStore() error = %v", err)
+			}
+			defer store.close()
+			if keys = restoredKeys(records); len(keys) != 3 {
+				t.Fatalf("restored records after reopening = %v, want 3 records", keys)
+			}
+		})
+	}
+}
+
+func TestOpenSubscriptionStoreRejectsCorruptedSnapshot(t *testing.T) {
+	var directory string = t.TempDir()
+	if err := os.WriteFile(filepath.Join(directory, SUBSCRIPTIONS_SNAPSHOT_FILE), []byte("[{\"op\":"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := openSubscriptionStore(directory); err == nil {
+		t.Fatal("openSubscriptionStore() accepted a corrupted snapshot")
+	}
+}
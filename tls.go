@@ -0,0 +1,189 @@
+package main
+
+//Archivo con la configuración TLS (opcional) del listener y de las conexiones a los suscriptores para enviarles los
+//archivos, y con la identificación de los clientes a partir de sus certificados
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+//Campos del certificado de un cliente de los que se puede obtener su identidad
+const (
+	CLIENT_IDENTITY_SUBJECT = "subject" //Common name del subject
+	CLIENT_IDENTITY_SAN     = "san"     //Primer nombre DNS, URI o email de los subject alternative names
+)
+
+//Configuración TLS de las conexiones a los suscriptores (nil: sin TLS). Se inicializa en main
+var deliveryTLS *tls.Config
+
+//Error retornado al enviar a un suscriptor cuya suscripción exige un certificado con cierta identidad, si los envíos no
+//verifican los certificados de los suscriptores (sin delivery-tls o con delivery-tls-skip-verify). No se reintenta
+var errUnverifiableIdentity = errors.New("subscriber identity can't be verified (requires delivery-tls with certificate verification)")
+
+//Constantes
+//Tamaño máximo del buffer de envío del sistema en las conexiones a los suscriptores. Con un buffer pequeño, las
+//escrituras solo terminan cuando el suscriptor lee el contenido, de manera que el timeout de los envíos (que se
+//renueva en cada escritura) mide el avance real y no el tiempo que tarda en vaciarse el buffer
+const DELIVERY_WRITE_BUFFER = 256 * 1024
+
+//Función que retorna la configuración TLS del listener a partir del certificado y la llave configurados (nil si no
+//se configuraron)
+func listenerTLSConfig() (*tls.Config, error) {
+	if config.TLSCertFile == "" {
+		return nil, nil
+	}
+	certificate, err := tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	var tlsConfig *tls.Config = &tls.Config{Certificates: []tls.Certificate{certificate}, MinVersion: tls.VersionTLS12}
+	//Verificar los certificados de los clientes (si los presentan, o siempre si son obligatorios)
+	if config.TLSClientCAFile != "" {
+		tlsConfig.ClientCAs, err = loadCertificatePool(config.TLSClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if config.RequireClientCertificate {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return tlsConfig, nil
+}
+
+//Función que retorna la configuración TLS de las conexiones a los suscriptores (nil si no se habilitó). Los
+//certificados de los suscriptores se verifican con la CA configurada o, si no se configuró una, con las del sistema
+func deliveryTLSConfig() (*tls.Config, error) {
+	if !config.DeliveryTLS {
+		return nil, nil
+	}
+	var tlsConfig *tls.Config = &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: config.DeliveryTLSSkipVerify}
+	if config.DeliveryCAFile != "" {
+		var err error
+		tlsConfig.RootCAs, err = loadCertificatePool(config.DeliveryCAFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tlsConfig, nil
+}
+
+//Función que carga los certificados (PEM) de un archivo de CAs
+func loadCertificatePool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var pool *x509.CertPool = x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %v", path)
+	}
+	return pool, nil
+}
+
+//Función que retorna la identidad correspondiente a un certificado según el campo configurado ("" si no tiene ese
+//campo)
+func certificateIdentity(certificate *x509.Certificate) string {
+	if config.ClientIdentity != CLIENT_IDENTITY_SAN {
+		return certificate.Subject.CommonName
+	}
+	if len(certificate.DNSNames) > 0 {
+		return certificate.DNSNames[0]
+	}
+	if len(certificate.URIs) > 0 {
+		return certificate.URIs[0].String()
+	}
+	if len(certificate.EmailAddresses) > 0 {
+		return certificate.EmailAddresses[0]
+	}
+	return ""
+}
+
+//Función que retorna la identidad del certificado (verificado) que presentó un cliente ("" si la conexión no usa TLS
+//o el cliente no presentó un certificado). Se debe llamar después del handshake (tras leer de la conexión)
+func connectionIdentity(connection net.Conn) string {
+	tlsConnection, isTLS := connection.(*tls.Conn)
+	if !isTLS {
+		return ""
+	}
+	var state tls.ConnectionState = tlsConnection.ConnectionState()
+	if len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		return ""
+	}
+	return certificateIdentity(state.PeerCertificates[0])
+}
+
+//Función que abre una conexión con un suscriptor (con TLS si está habilitado para los envíos). Si identity no está
+//vacío, el certificado del suscriptor debe corresponder a esa identidad (la registrada al suscribirse)
+func dialSubscriber(address string, identity string, timeout time.Duration) (net.Conn, error) {
+	//La identidad solo se puede comprobar con un certificado verificado (uno sin verificar lo puede generar cualquiera)
+	if identity != "" && (deliveryTLS == nil || deliveryTLS.InsecureSkipVerify) {
+		return nil, errUnverifiableIdentity
+	}
+	plainConnection, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if tcpConnection, isTCP := plainConnection.(*net.TCPConn); isTCP {
+		tcpConnection.SetWriteBuffer(DELIVERY_WRITE_BUFFER)
+	}
+	if deliveryTLS == nil {
+		return plainConnection, nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		plainConnection.Close()
+		return nil, err
+	}
+	//El certificado del suscriptor debe corresponder al host de la dirección con la que se suscribió
+	var tlsConfig *tls.Config = deliveryTLS.Clone()
+	tlsConfig.ServerName = host
+	//El timeout también limita el handshake
+	var connection *tls.Conn = tls.Client(plainConnection, tlsConfig)
+	if timeout > 0 {
+		connection.SetDeadline(time.Now().Add(timeout))
+	}
+	if err := connection.Handshake(); err != nil {
+		connection.Close()
+		return nil, err
+	}
+	connection.SetDeadline(time.Time{})
+	if identity == "" {
+		return connection, nil
+	}
+	var peerCertificates []*x509.Certificate = connection.ConnectionState().PeerCertificates
+	if len(peerCertificates) == 0 || certificateIdentity(peerCertificates[0]) != identity {
+		connection.Close()
+		return nil, fmt.Errorf("subscriber certificate does not match the identity %q of the subscription", identity)
+	}
+	return connection, nil
+}
+
+//Función que valida las opciones de TLS de la configuración
+func (c *serverConfig) validateTLS() error {
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return errors.New("tls-cert-file and tls-key-file must be set together")
+	}
+	if !c.DeliveryTLS && (c.DeliveryCAFile != "" || c.DeliveryTLSSkipVerify) {
+		return errors.New("delivery-ca-file and delivery-tls-skip-verify require delivery-tls")
+	}
+	if c.TLSClientCAFile != "" && c.TLSCertFile == "" {
+		return errors.New("tls-client-ca-file requires tls-cert-file")
+	}
+	if c.TLSClientCAFile != "" && (!c.DeliveryTLS || c.DeliveryTLSSkipVerify) {
+		return errors.New("tls-client-ca-file requires delivery-tls with certificate verification (to verify subscribers' identity)")
+	}
+	if c.RequireClientCertificate && c.TLSClientCAFile == "" {
+		return errors.New("require-client-certificate requires tls-client-ca-file")
+	}
+	if c.ClientIdentity != CLIENT_IDENTITY_SUBJECT && c.ClientIdentity != CLIENT_IDENTITY_SAN {
+		return fmt.Errorf("invalid client-identity %q (allowed: %v, %v)", c.ClientIdentity, CLIENT_IDENTITY_SUBJECT, CLIENT_IDENTITY_SAN)
+	}
+	return nil
+}
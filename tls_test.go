@@ -0,0 +1,313 @@
+package main
+
+//Pruebas de la configuración TLS con certificados generados al ejecutar las pruebas (no requieren archivos ni red
+//externa)
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//Certificado generado para las pruebas
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	certFile    string //Certificado en PEM
+	keyFile     string //Llave privada en PEM
+}
+
+//Función que genera una CA de prueba (autofirmada)
+func newTestCA(t *testing.T, name string) *testCertificate {
+	t.Helper()
+	var template *x509.Certificate = &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	return signTestCertificate(t, template, nil)
+}
+
+//Función que genera un certificado de prueba firmado por la CA indicada, válido para 127.0.0.1 como servidor y como
+//cliente
+func newTestLeaf(t *testing.T, ca *testCertificate, commonName string) *testCertificate {
+	t.Helper()
+	var template *x509.Certificate = &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{commonName + ".example"},
+	}
+	return signTestCertificate(t, template, ca)
+}
+
+//Función que firma un certificado (con la CA indicada, o autofirmado si es nil) y lo guarda en archivos PEM
+func signTestCertificate(t *testing.T, template *x509.Certificate, ca *testCertificate) *testCertificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parent *x509.Certificate = template
+	var parentKey *ecdsa.PrivateKey = key
+	if ca != nil {
+		parent, parentKey = ca.certificate, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var directory string = t.TempDir()
+	var generated *testCertificate = &testCertificate{certificate: certificate, key: key, certFile: filepath.Join(directory, "cert.pem"), keyFile: filepath.Join(directory, "key.pem")}
+	writeTestPEM(t, generated.certFile, "CERTIFICATE", der)
+	writeTestPEM(t, generated.keyFile, "EC PRIVATE KEY", keyDER)
+	return generated
+}
+
+//Función que escribe un bloque PEM en un archivo
+func writeTestPEM(t *testing.T, path string, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//Función que reemplaza la configuración global durante una prueba
+func useTestConfig(t *testing.T, modify func(c *serverConfig)) {
+	var previous serverConfig = config
+	var previousDelivery *tls.Config = deliveryTLS
+	config = defaultConfig()
+	modify(&config)
+	t.Cleanup(func() {
+		config = previous
+		deliveryTLS = previousDelivery
+	})
+}
+
+//Función que inicia un listener TLS de prueba (un suscriptor) que completa el handshake de cada conexión y la cierra
+func startTestSubscriber(t *testing.T, certificate *testCertificate) string {
+	t.Helper()
+	pair, err := tls.LoadX509KeyPair(certificate.certFile, certificate.keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{pair}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			connection, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			connection.(*tls.Conn).Handshake()
+			connection.Close()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestListenerTLSConfigDisabled(t *testing.T) {
+	useTestConfig(t, func(c *serverConfig) {})
+	tlsConfig, err := listenerTLSConfig()
+	if err != nil || tlsConfig != nil {
+		t.Fatalf("listenerTLSConfig() = %v, %v; want nil, nil", tlsConfig, err)
+	}
+}
+
+func TestListenerTLSConfig(t *testing.T) {
+	var ca *testCertificate = newTestCA(t, "test-ca")
+	var server *testCertificate = newTestLeaf(t, ca, "server")
+	useTestConfig(t, func(c *serverConfig) {
+		c.TLSCertFile, c.TLSKeyFile = server.certFile, server.keyFile
+	})
+	tlsConfig, err := listenerTLSConfig()
+	if err != nil {
+		t.Fatalf("listenerTLSConfig: %v", err)
+	}
+	//Un cliente que confía en la CA debe poder completar el handshake con el listener
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		if connection, err := listener.Accept(); err == nil {
+			connection.(*tls.Conn).Handshake()
+			connection.Close()
+		}
+	}()
+	var roots *x509.CertPool = x509.NewCertPool()
+	roots.AddCert(ca.certificate)
+	connection, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"})
+	if err != nil {
+		t.Fatalf("handshake with the listener: %v", err)
+	}
+	connection.Close()
+}
+
+func TestListenerTLSConfigInvalidKeyPair(t *testing.T) {
+	var ca *testCertificate = newTestCA(t, "test-ca")
+	var server *testCertificate = newTestLeaf(t, ca, "server")
+	var other *testCertificate = newTestLeaf(t, ca, "other")
+	useTestConfig(t, func(c *serverConfig) {
+		c.TLSCertFile, c.TLSKeyFile = server.certFile, other.keyFile
+	})
+	if _, err := listenerTLSConfig(); err == nil {
+		t.Fatal("listenerTLSConfig accepted a key that doesn't match the certificate")
+	}
+}
+
+func TestDeliveryTLSConfig(t *testing.T) {
+	var ca *testCertificate = newTestCA(t, "test-ca")
+	useTestConfig(t, func(c *serverConfig) {
+		c.DeliveryTLS, c.DeliveryCAFile = true, ca.certFile
+	})
+	tlsConfig, err := deliveryTLSConfig()
+	if err != nil {
+		t.Fatalf("deliveryTLSConfig: %v", err)
+	}
+	if tlsConfig == nil || tlsConfig.RootCAs == nil || tlsConfig.InsecureSkipVerify {
+		t.Fatalf("deliveryTLSConfig() = %+v, want a verifying configuration with the test CA", tlsConfig)
+	}
+	//Sin delivery-tls no hay configuración
+	config.DeliveryTLS = false
+	if tlsConfig, err := deliveryTLSConfig(); err != nil || tlsConfig != nil {
+		t.Fatalf("deliveryTLSConfig() without delivery-tls = %v, %v; want nil, nil", tlsConfig, err)
+	}
+}
+
+func TestDeliveryTLSConfigInvalidCA(t *testing.T) {
+	var path string = filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(path, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	useTestConfig(t, func(c *serverConfig) {
+		c.DeliveryTLS, c.DeliveryCAFile = true, path
+	})
+	if _, err := deliveryTLSConfig(); err == nil {
+		t.Fatal("deliveryTLSConfig accepted a CA file without certificates")
+	}
+}
+
+func TestDialSubscriber(t *testing.T) {
+	var ca *testCertificate = newTestCA(t, "test-ca")
+	var address string = startTestSubscriber(t, newTestLeaf(t, ca, "subscriber"))
+	useTestConfig(t, func(c *serverConfig) {
+		c.DeliveryTLS, c.DeliveryCAFile = true, ca.certFile
+	})
+	var err error
+	if deliveryTLS, err = deliveryTLSConfig(); err != nil {
+		t.Fatal(err)
+	}
+	connection, err := dialSubscriber(address, "", time.Second)
+	if err != nil {
+		t.Fatalf("dialSubscriber: %v", err)
+	}
+	connection.Close()
+}
+
+func TestDialSubscriberUnknownCA(t *testing.T) {
+	var trusted *testCertificate = newTestCA(t, "trusted-ca")
+	var rogue *testCertificate = newTestCA(t, "rogue-ca")
+	var address string = startTestSubscriber(t, newTestLeaf(t, rogue, "subscriber"))
+	useTestConfig(t, func(c *serverConfig) {
+		c.DeliveryTLS, c.DeliveryCAFile = true, trusted.certFile
+	})
+	var err error
+	if deliveryTLS, err = deliveryTLSConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if connection, err := dialSubscriber(address, "", time.Second); err == nil {
+		connection.Close()
+		t.Fatal("dialSubscriber accepted a certificate signed by an unknown CA")
+	}
+}
+
+func TestDialSubscriberPlain(t *testing.T) {
+	useTestConfig(t, func(c *serverConfig) {})
+	deliveryTLS = nil
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	connection, err := dialSubscriber(listener.Addr().String(), "", time.Second)
+	if err != nil {
+		t.Fatalf("dialSubscriber without TLS: %v", err)
+	}
+	if _, isTLS := connection.(*tls.Conn); isTLS {
+		t.Fatal("dialSubscriber used TLS with delivery-tls disabled")
+	}
+	connection.Close()
+}
+
+func TestDialSubscriberIdentity(t *testing.T) {
+	var ca *testCertificate = newTestCA(t, "test-ca")
+	var address string = startTestSubscriber(t, newTestLeaf(t, ca, "alice"))
+	useTestConfig(t, func(c *serverConfig) {
+		c.DeliveryTLS, c.DeliveryCAFile = true, ca.certFile
+	})
+	var err error
+	if deliveryTLS, err = deliveryTLSConfig(); err != nil {
+		t.Fatal(err)
+	}
+	connection, err := dialSubscriber(address, "alice", time.Second)
+	if err != nil {
+		t.Fatalf("dialSubscriber with the subscription's identity: %v", err)
+	}
+	connection.Close()
+	if connection, err := dialSubscriber(address, "mallory", time.Second); err == nil {
+		connection.Close()
+		t.Fatal("dialSubscriber accepted a certificate with another identity")
+	}
+}
+
+func TestDialSubscriberUnverifiableIdentity(t *testing.T) {
+	var ca *testCertificate = newTestCA(t, "test-ca")
+	var address string = startTestSubscriber(t, newTestLeaf(t, ca, "alice"))
+	//Sin TLS y sin verificar los certificados no se puede comprobar la identidad del suscriptor
+	for _, skipVerify := range []bool{false, true} {
+		useTestConfig(t, func(c *serverConfig) {
+			c.DeliveryTLS, c.DeliveryTLSSkipVerify = skipVerify, skipVerify
+		})
+		var err error
+		if deliveryTLS, err = deliveryTLSConfig(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := dialSubscriber(address, "alice", time.Second); err != errUnverifiableIdentity {
+			t.Fatalf("dialSubscriber (skip verify: %v) = %v, want %v", skipVerify, err, errUnverifiableIdentity)
+		}
+		if isRetryableDelivery(errUnverifiableIdentity) {
+			t.Fatal("a delivery with an unverifiable identity is retried")
+		}
+	}
+}
@@ -3,105 +3,180 @@ package main
 //Archivo con funciones de apoyo para el procesamiento de mensajes y solicitudes
 
 import (
-	"encoding/binary"
+	"Server/protocol"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"net"
 	"strconv"
+	"time"
 )
 
 //Función que crea un mensaje con la estructura estándar del protocolo
 func createSimpleMessage(command int8, channel int8, body []byte) []byte {
-	//Variables para el mensaje y cada una de sus partes
-	var message []byte
-	//Convertir el comando y añadirlo al mensaje
-	message = append(message, byte(command))
-	//Convertir el canal y añadirlo al mensaje
-	message = append(message, byte(channel))
-	//Obtener la longitud del contenido del mensaje
-	var contentLength int64 = int64(len(body))
-	var lengthBuffer []byte = make([]byte, 8)
-	binary.LittleEndian.PutUint64(lengthBuffer, uint64(contentLength))
-	//Añadir la longitud al mensaje
-	message = append(message, lengthBuffer...)
-	//Añadir el cuerpo o contenido al mensaje
-	message = append(message, body...)
+	return protocol.Frame{Command: command, Channel: channel, Body: body}.Bytes()
+}
 
-	//Retornar el mensaje ya lleno
-	return message
+//Función que retorna el motivo (enviado al cliente) correspondiente a un error del decodificador
+func decodeErrorReason(err error) string {
+	var readError *protocol.ReadError
+	if errors.As(err, &readError) {
+		return readError.Field + " read error"
+	}
+	var headerError *protocol.HeaderError
+	if errors.As(err, &headerError) {
+		return headerError.Err.Error()
+	}
+	return err.Error()
 }
 
-//Función que procesa un mensaje (exceptuando el comando) relacionado con una suscripción de un cliente
-func processSubscriptionMessage(connection net.Conn) (returnChannel int8, returnAddress string, returnStatus int) {
-	var channelBuffer []byte = make([]byte, 1) //Buffer que recibe el canal de la suscripción
-	var lengthBuffer []byte = make([]byte, 8)  //Buffer que recibe la longitud del contenido (en este caso la dirección del cliente)
-	var contentBuffer []byte
-	//Leer el canal al que el cliente se desea suscribir
-	_, channelError := connection.Read(channelBuffer)
+//Función que lee el header de un mensaje. Si no es válido responde con un notify-failure y retorna ok = false junto
+//con el código de resultado de la conexión
+func processHeader(connection net.Conn, decoder *protocol.Decoder) (returnHeader protocol.Header, returnStatus int, returnOk bool) {
+	header, headerError := decoder.DecodeHeader()
 	//Error check
-	if channelError != nil {
-		fmt.Println("ERROR: Error while reading client's selected channel: " + channelError.Error())
-		_, err := connection.Write(createSimpleMessage(3, 0, []byte("channel read error")))
-		if err != nil {
-			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
-		}
-		return -1, "", 2
+	if headerError == nil {
+		return header, 0, true
 	}
-	//Leer la longitud del contenido en el mensaje
-	_, lengthError := connection.Read(lengthBuffer)
-	//Error check
-	if lengthError != nil {
-		fmt.Println("ERROR: Error while reading message's content length: " + lengthError.Error())
-		_, err := connection.Write(createSimpleMessage(3, 0, []byte("length read error")))
-		if err != nil {
-			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
-		}
-		return -1, "", 2
+	var status int
+	if errors.Is(headerError, protocol.ErrInvalidCommand) {
+		//Comando inválido
+		fmt.Println("Received invalid command. Closing connection...")
+		status = 0
+	} else {
+		fmt.Println("ERROR: Error while reading client's message header: " + headerError.Error())
+		status = 2
+	}
+	_, err := connection.Write(createSimpleMessage(3, 0, []byte(decodeErrorReason(headerError))))
+	if err != nil {
+		fmt.Println("ERROR: Error while sending response to client: " + err.Error())
 	}
-	//Parsear el canal recibido
-	var channel int8
-	channel = int8(channelBuffer[0])
-	//Comprobar que el canal recibido sea válido
-	if channel < 1 || channel > NUMBER_OF_CHANNELS {
+	return header, status, false
+}
+
+//Función que obtiene el canal al que se dirige un mensaje: el canal numerado indicado en el header o, si el header
+//indica protocol.NAMED_CHANNEL, el nombre al inicio del contenido (que se descuenta de la longitud del header)
+func processChannel(connection net.Conn, decoder *protocol.Decoder, header *protocol.Header) (returnChannel string, returnStatus int) {
+	var reason string
+	var status int
+	if header.Channel != protocol.NAMED_CHANNEL {
+		//Comprobar que el canal numerado sea válido
+		if channel := numberedChannel(header.Channel); channel != "" {
+			return channel, 0
+		}
 		fmt.Println("ERROR: The client's message specified an invalid channel")
-		_, err := connection.Write(createSimpleMessage(3, 0, []byte("invalid channel (allowed channels: 1-"+strconv.Itoa(NUMBER_OF_CHANNELS)+")")))
-		if err != nil {
-			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+		reason, status = "invalid channel (allowed channels: 1-"+strconv.Itoa(config.NumberOfChannels)+" or a channel name)", 3
+	} else {
+		//Leer el nombre del canal
+		channel, channelError := decoder.DecodeChannelName(header)
+		//Los patrones de canales solo son válidos en las suscripciones
+		if channelError == nil && protocol.IsChannelPattern(channel) && header.Command != protocol.COMMAND_SUBSCRIBE &&
+			header.Command != protocol.COMMAND_UNSUBSCRIBE && header.Command != protocol.COMMAND_LIST_SUBSCRIBERS {
+			channelError = protocol.ErrUnexpectedWildcard
+		}
+		if channelError == nil {
+			return channel, 0
 		}
-		return -1, "", 2
+		if errors.Is(channelError, protocol.ErrInvalidChannelName) || errors.Is(channelError, protocol.ErrUnexpectedWildcard) {
+			fmt.Println("ERROR: The client's message specified an invalid channel name")
+			reason, status = channelError.Error(), 3
+		} else {
+			fmt.Println("ERROR: Error while reading channel name: " + channelError.Error())
+			reason, status = decodeErrorReason(channelError), 2
+		}
+	}
+	_, err := connection.Write(createSimpleMessage(3, 0, []byte(reason)))
+	if err != nil {
+		fmt.Println("ERROR: Error while sending response to client: " + err.Error())
 	}
-	//Parsear la longitud del contenido
-	var contentLength int64
-	contentLength = int64(binary.LittleEndian.Uint64(lengthBuffer))
+	return "", status
+}
+
+//Función que procesa un mensaje (exceptuando el header y el canal) relacionado con una suscripción de un cliente
+func processSubscriptionMessage(connection net.Conn, decoder *protocol.Decoder, header protocol.Header) (returnAddress string, returnOptions protocol.SubscribeOptions, returnStatus int) {
+	var contentBuffer []byte
 	//Comprobar que la longitud sea válida
-	if contentLength <= 0 {
+	var contentLength int64 = header.Length
+	if contentLength <= 0 || contentLength > protocol.SUBSCRIPTION_MAX_LENGTH {
 		fmt.Println("ERROR: The client's message specified an invalid content length")
 		_, err := connection.Write(createSimpleMessage(3, 0, []byte("invalid content length")))
 		if err != nil {
 			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
 		}
-		return -1, "", 3
+		return "", protocol.SubscribeOptions{}, 3
 	}
-	//Leer el contenido del mensaje (dirección del cliente: IP + PORT)
+	//Leer el contenido del mensaje (dirección del cliente: IP + PORT, y opcionalmente las opciones de la suscripción)
 	contentBuffer = make([]byte, contentLength)
-	n, contentError := connection.Read(contentBuffer)
+	contentError := decoder.ReadField("content", contentBuffer)
 	//Error check
 	if contentError != nil {
 		fmt.Println("ERROR: Error while reading message's content: " + contentError.Error())
-		_, err := connection.Write(createSimpleMessage(3, 0, []byte("content read error")))
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte(decodeErrorReason(contentError))))
 		if err != nil {
 			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
 		}
-		return -1, "", 2
+		return "", protocol.SubscribeOptions{}, 2
 	}
-	if int64(n) != contentLength {
-		fmt.Printf("ERROR: Could not read content completely (expected: %d, real: %d)\n", contentLength, n)
-		_, err := connection.Write(createSimpleMessage(3, 0, []byte("content incomplete read")))
+	//Parsear el contenido
+	clientAddress, options, optionsError := protocol.DecodeSubscription(contentBuffer)
+	if optionsError != nil {
+		fmt.Println("ERROR: The client's message specified invalid subscription options")
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte(optionsError.Error())))
 		if err != nil {
 			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
 		}
-		return -1, "", 2
+		return "", protocol.SubscribeOptions{}, 3
 	}
-	//Parsear el contenido
-	var clientAddress string = string(contentBuffer)
-	return channel, clientAddress, 0
+	return clientAddress, options, 0
+}
+
+//Función que indica si un token corresponde al token de administración configurado (si no hay uno configurado,
+//ningún token es válido)
+func isAdminToken(token []byte) bool {
+	if config.AdminToken == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare(token, []byte(config.AdminToken)) == 1
+}
+
+//Error retornado cuando el contenido de un archivo no corresponde al digest indicado por el cliente
+var errDigestMismatch = errors.New("checksum mismatch")
+
+//Función que procesa un mensaje digest (digest SHA-256 del archivo que el cliente enviará a continuación)
+func processDigest(connection net.Conn, decoder *protocol.Decoder, header protocol.Header) (returnDigest []byte, returnStatus int) {
+	if header.Length != protocol.DIGEST_SIZE {
+		fmt.Println("ERROR: The client's message specified an invalid content length")
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte("invalid content length")))
+		if err != nil {
+			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+		}
+		return nil, 3
+	}
+	var digestBuffer []byte = make([]byte, protocol.DIGEST_SIZE)
+	if digestError := decoder.ReadField("digest", digestBuffer); digestError != nil {
+		fmt.Println("ERROR: Error while reading message's content: " + digestError.Error())
+		_, err := connection.Write(createSimpleMessage(3, 0, []byte(decodeErrorReason(digestError))))
+		if err != nil {
+			fmt.Println("ERROR: Error while sending response to client: " + err.Error())
+		}
+		return nil, 2
+	}
+	return digestBuffer, 0
+}
+
+//Conexión que renueva su deadline antes de cada lectura y escritura, de manera que el timeout limita el tiempo sin
+//actividad y no la duración total de la transferencia
+type idleTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *idleTimeoutConn) Read(buffer []byte) (int, error) {
+	c.Conn.SetDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Read(buffer)
+}
+
+func (c *idleTimeoutConn) Write(buffer []byte) (int, error) {
+	c.Conn.SetDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Write(buffer)
 }